@@ -0,0 +1,45 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum-optimism/optimism/op-service/client"
+)
+
+const depositContractMethod = "eth/v1/config/deposit_contract"
+
+type depositContractResponse struct {
+	Data struct {
+		ChainID string `json:"chain_id"`
+	} `json:"data"`
+}
+
+// VerifyBeaconChainID checks that the beacon node serves the same network as the L1 execution client,
+// by comparing the chain ID of the beacon node's deposit contract against chainID.
+// A beacon node of a different network would return wrong or no blob sidecars.
+func VerifyBeaconChainID(ctx context.Context, cl client.HTTP, chainID *big.Int) error {
+	resp, err := cl.Get(ctx, depositContractMethod, nil, http.Header{"Accept": []string{"application/json"}})
+	if err != nil {
+		return fmt.Errorf("failed to fetch beacon deposit contract: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch beacon deposit contract: status %v", resp.StatusCode)
+	}
+	var contract depositContractResponse
+	if err := json.NewDecoder(resp.Body).Decode(&contract); err != nil {
+		return fmt.Errorf("failed to decode beacon deposit contract: %w", err)
+	}
+	beaconChainID, ok := new(big.Int).SetString(contract.Data.ChainID, 10)
+	if !ok {
+		return fmt.Errorf("invalid beacon deposit contract chain ID %q", contract.Data.ChainID)
+	}
+	if beaconChainID.Cmp(chainID) != 0 {
+		return fmt.Errorf("L1 Beacon node serves chain ID %v but the L1 RPC serves chain ID %v", beaconChainID, chainID)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyBeaconChainID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/"+depositContractMethod, r.URL.Path)
+		_, _ = fmt.Fprint(w, `{"data":{"chain_id":"17000","address":"0x4242424242424242424242424242424242424242"}}`)
+	}))
+	defer server.Close()
+	cl := client.NewBasicHTTPClient(server.URL, nil)
+
+	require.NoError(t, VerifyBeaconChainID(context.Background(), cl, big.NewInt(17000)))
+
+	err := VerifyBeaconChainID(context.Background(), cl, big.NewInt(1))
+	require.ErrorContains(t, err, "L1 Beacon node serves chain ID 17000 but the L1 RPC serves chain ID 1")
+}
+
+func TestVerifyBeaconChainIDUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	cl := client.NewBasicHTTPClient(server.URL, nil)
+
+	require.ErrorContains(t, VerifyBeaconChainID(context.Background(), cl, big.NewInt(1)), "status 404")
+}
@@ -0,0 +1,98 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// limitedBlobsFetcher bounds the number of concurrent blob sidecar requests sent to the beacon node,
+// independently of how many L1 blocks are fetched concurrently.
+type limitedBlobsFetcher struct {
+	fetcher derive.L1BlobsFetcher
+	sem     chan struct{}
+}
+
+// newLimitedBlobsFetcher wraps fetcher so that at most limit GetBlobs calls are in flight at once.
+// A limit of zero leaves the fetcher unbounded.
+func newLimitedBlobsFetcher(fetcher derive.L1BlobsFetcher, limit uint64) derive.L1BlobsFetcher {
+	if limit == 0 {
+		return fetcher
+	}
+	return &limitedBlobsFetcher{
+		fetcher: fetcher,
+		sem:     make(chan struct{}, limit),
+	}
+}
+
+func (l *limitedBlobsFetcher) GetBlobs(ctx context.Context, ref eth.L1BlockRef, hashes []eth.IndexedBlobHash) ([]*eth.Blob, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-l.sem }()
+	return l.fetcher.GetBlobs(ctx, ref, hashes)
+}
+
+// BlockBlob is the data of a single blob of an L1 block.
+type BlockBlob struct {
+	TxHash common.Hash `json:"transaction_hash"`
+	// Index is the index of the blob in the block's blob sidecars.
+	Index         uint64      `json:"index"`
+	VersionedHash common.Hash `json:"versioned_hash"`
+	Data          eth.Data    `json:"-"`
+}
+
+// BlockBlobs fetches the blobs of the blob transactions of an L1 block from the beacon node, without
+// caching them. Only blobs of transactions sent to inbox are returned, unless it is the zero address, and
+// only the blob with the given versioned hash if it is set. An error is returned if no blob matches.
+func BlockBlobs(ctx context.Context, client L1Client, beacon derive.L1BlobsFetcher, number uint64, inbox common.Address, versionedHash common.Hash) ([]BlockBlob, error) {
+	block, err := client.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch L1 block %d: %w", number, err)
+	}
+	ref := eth.L1BlockRef{
+		Hash:       block.Hash(),
+		Number:     block.NumberU64(),
+		ParentHash: block.ParentHash(),
+		Time:       block.Time(),
+	}
+	var (
+		out    []BlockBlob
+		hashes []eth.IndexedBlobHash
+	)
+	blobIndex := uint64(0) // index of each blob in the block's blob sidecar
+	for _, tx := range block.Transactions() {
+		for _, h := range tx.BlobHashes() {
+			toInbox := inbox == (common.Address{}) || (tx.To() != nil && *tx.To() == inbox)
+			if toInbox && (versionedHash == (common.Hash{}) || h == versionedHash) {
+				out = append(out, BlockBlob{TxHash: tx.Hash(), Index: blobIndex, VersionedHash: h})
+				hashes = append(hashes, eth.IndexedBlobHash{Index: blobIndex, Hash: h})
+			}
+			blobIndex++
+		}
+	}
+	if len(out) == 0 {
+		if versionedHash != (common.Hash{}) {
+			return nil, fmt.Errorf("L1 block %d has no blob %v sent to the batch inbox", number, versionedHash)
+		}
+		return nil, fmt.Errorf("L1 block %d has no blobs sent to the batch inbox", number)
+	}
+	blobs, err := beacon.GetBlobs(ctx, ref, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch blobs of L1 block %d: %w", number, err)
+	}
+	for i, blob := range blobs {
+		data, err := blob.ToData()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse blob %v: %w", out[i].VersionedHash, err)
+		}
+		out[i].Data = data
+	}
+	return out, nil
+}
@@ -0,0 +1,129 @@
+package fetch
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+type slowBlobsFetcher struct {
+	inFlight    atomic.Int64
+	maxInFlight atomic.Int64
+}
+
+func (f *slowBlobsFetcher) GetBlobs(ctx context.Context, ref eth.L1BlockRef, hashes []eth.IndexedBlobHash) ([]*eth.Blob, error) {
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		peak := f.maxInFlight.Load()
+		if n <= peak || f.maxInFlight.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return nil, nil
+}
+
+func TestLimitedBlobsFetcher(t *testing.T) {
+	run := func(t *testing.T, limit uint64, callers int) int64 {
+		inner := new(slowBlobsFetcher)
+		fetcher := newLimitedBlobsFetcher(inner, limit)
+		var wg sync.WaitGroup
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := fetcher.GetBlobs(context.Background(), eth.L1BlockRef{}, nil)
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		return inner.maxInFlight.Load()
+	}
+
+	t.Run("Limited", func(t *testing.T) {
+		require.LessOrEqual(t, run(t, 2, 10), int64(2))
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		inner := new(slowBlobsFetcher)
+		require.Same(t, inner, newLimitedBlobsFetcher(inner, 0))
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		fetcher := newLimitedBlobsFetcher(new(slowBlobsFetcher), 1)
+		limited := fetcher.(*limitedBlobsFetcher)
+		limited.sem <- struct{}{} // occupy the only slot
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := fetcher.GetBlobs(ctx, eth.L1BlockRef{}, nil)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// recordingBlobsFetcher records the blob hashes requested from a fakeBlobsFetcher.
+type recordingBlobsFetcher struct {
+	fakeBlobsFetcher
+	requested []eth.IndexedBlobHash
+}
+
+func (f *recordingBlobsFetcher) GetBlobs(ctx context.Context, ref eth.L1BlockRef, hashes []eth.IndexedBlobHash) ([]*eth.Blob, error) {
+	f.requested = append(f.requested, hashes...)
+	return f.fakeBlobsFetcher.GetBlobs(ctx, ref, hashes)
+}
+
+func TestBlockBlobs(t *testing.T) {
+	key := newTestKey(t)
+	signer := types.LatestSignerForChainID(testChainID)
+	other := common.Address{0x01}
+	newBlobTx := func(nonce uint64, to common.Address, hashes ...common.Hash) *types.Transaction {
+		return types.MustSignNewTx(key.priv, signer, &types.BlobTx{
+			ChainID:    uint256.MustFromBig(testChainID),
+			Nonce:      nonce,
+			To:         to,
+			BlobHashes: hashes,
+		})
+	}
+	otherTx := newBlobTx(0, other, common.Hash{0x01})
+	inboxTx := newBlobTx(1, testInbox, common.Hash{0x02}, common.Hash{0x03})
+	client := &fakeL1Client{blocks: map[uint64]*types.Block{
+		10: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(10)}).WithBody(types.Body{Transactions: []*types.Transaction{otherTx, inboxTx}}),
+		11: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(11)}).WithBody(types.Body{Transactions: []*types.Transaction{otherTx}}),
+	}}
+	data := eth.Data{derive.DerivationVersion0, 0x01}
+
+	t.Run("Inbox", func(t *testing.T) {
+		beacon := &recordingBlobsFetcher{fakeBlobsFetcher: fakeBlobsFetcher{data: data}}
+		blobs, err := BlockBlobs(context.Background(), client, beacon, 10, testInbox, common.Hash{})
+		require.NoError(t, err)
+		require.Equal(t, []BlockBlob{
+			{TxHash: inboxTx.Hash(), Index: 1, VersionedHash: common.Hash{0x02}, Data: data},
+			{TxHash: inboxTx.Hash(), Index: 2, VersionedHash: common.Hash{0x03}, Data: data},
+		}, blobs)
+		require.Equal(t, []eth.IndexedBlobHash{{Index: 1, Hash: common.Hash{0x02}}, {Index: 2, Hash: common.Hash{0x03}}}, beacon.requested)
+	})
+
+	t.Run("VersionedHash", func(t *testing.T) {
+		beacon := &recordingBlobsFetcher{fakeBlobsFetcher: fakeBlobsFetcher{data: data}}
+		blobs, err := BlockBlobs(context.Background(), client, beacon, 10, common.Address{}, common.Hash{0x01})
+		require.NoError(t, err)
+		require.Equal(t, []BlockBlob{{TxHash: otherTx.Hash(), Index: 0, VersionedHash: common.Hash{0x01}, Data: data}}, blobs)
+	})
+
+	t.Run("NoBatcherBlobs", func(t *testing.T) {
+		beacon := &recordingBlobsFetcher{fakeBlobsFetcher: fakeBlobsFetcher{data: data}}
+		_, err := BlockBlobs(context.Background(), client, beacon, 11, testInbox, common.Hash{})
+		require.ErrorContains(t, err, "no blobs sent to the batch inbox")
+		require.Empty(t, beacon.requested, "the beacon node must not be queried")
+	})
+}
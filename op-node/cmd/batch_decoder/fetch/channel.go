@@ -0,0 +1,69 @@
+package fetch
+
+import (
+	"sync"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// channelFilter returns the channel the configured fetch is restricted to, or nil if all transactions are cached.
+func (c Config) channelFilter() *derive.ChannelID {
+	if c.Channel == (derive.ChannelID{}) {
+		return nil
+	}
+	id := c.Channel
+	return &id
+}
+
+// countChannelFrames returns the number of frames which belong to the channel.
+func countChannelFrames(frames []derive.Frame, id derive.ChannelID) uint64 {
+	var n uint64
+	for _, frame := range frames {
+		if frame.ID == id {
+			n++
+		}
+	}
+	return n
+}
+
+// frameCounter counts the frames of the filtered channel found per block. The counts of a block are
+// reset before it is fetched again, so retries don't count frames twice.
+type frameCounter struct {
+	mu     sync.Mutex
+	counts map[uint64]uint64
+}
+
+func newFrameCounter() *frameCounter {
+	return &frameCounter{counts: make(map[uint64]uint64)}
+}
+
+func (f *frameCounter) add(block uint64, n uint64) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[block] += n
+}
+
+func (f *frameCounter) reset(block uint64) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.counts, block)
+}
+
+func (f *frameCounter) total() uint64 {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var total uint64
+	for _, n := range f.counts {
+		total += n
+	}
+	return total
+}
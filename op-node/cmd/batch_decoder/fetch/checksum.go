@@ -0,0 +1,141 @@
+package fetch
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChecksumFile is the name of the file in every cache directory which lists the SHA-256 checksums
+// of its transaction files, in the format of sha256sum.
+const ChecksumFile = "SHA256SUMS"
+
+// IsMetadataFile reports whether a file of the cache directory describes the cache, rather than
+// holding a cached transaction. This includes the temporary file a manifest is written to before it
+// replaces the previous one.
+func IsMetadataFile(name string) bool {
+	return name == ManifestFile || name == ManifestFile+".tmp" || name == ChecksumFile
+}
+
+// checksumMu serializes appends to the checksum files by concurrent fetch workers.
+var checksumMu sync.Mutex
+
+// appendChecksum records the checksum of a written cache file in the checksum file of its directory.
+// A file which is written again, e.g. by a retry, is listed again, and its last checksum is the valid one.
+func appendChecksum(filename string, sum []byte) error {
+	checksumMu.Lock()
+	defer checksumMu.Unlock()
+	f, err := os.OpenFile(path.Join(path.Dir(filename), ChecksumFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%x  %s\n", sum, path.Base(filename)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// VerifyCache checks every file of the transaction cache in dir against the checksums fetch recorded
+// for it, and reports files which are corrupt, missing or have no checksum.
+// Files are hashed as they are read, so even large caches are verified in constant memory.
+func VerifyCache(dir string) ([]CacheIssue, error) {
+	var issues []CacheIssue
+	if err := verifyCacheDir(dir, &issues); err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+func verifyCacheDir(dir string, issues *[]CacheIssue) error {
+	sums, err := loadChecksums(dir, issues)
+	if err != nil {
+		return err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool)
+	for _, file := range files {
+		f := path.Join(dir, file.Name())
+		if file.IsDir() {
+			if err := verifyCacheDir(f, issues); err != nil {
+				return err
+			}
+			continue
+		}
+		if IsMetadataFile(file.Name()) || path.Ext(f) != ".json" {
+			continue
+		}
+		present[file.Name()] = true
+		expected, ok := sums[file.Name()]
+		if !ok {
+			*issues = append(*issues, CacheIssue{IssueMissingChecksum, fmt.Sprintf("%v: no checksum recorded", f)})
+			continue
+		}
+		actual, err := fileChecksum(f)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			*issues = append(*issues, CacheIssue{IssueChecksumMismatch,
+				fmt.Sprintf("%v: checksum %v, expected %v", f, actual, expected)})
+		}
+	}
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		if !present[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		*issues = append(*issues, CacheIssue{IssueMissingFile, fmt.Sprintf("%v: listed in %v, but missing", path.Join(dir, name), ChecksumFile)})
+	}
+	return nil
+}
+
+// loadChecksums reads the checksum file of dir, if any. Malformed lines are reported as issues.
+func loadChecksums(dir string, issues *[]CacheIssue) (map[string]string, error) {
+	sums := make(map[string]string)
+	f, err := os.Open(path.Join(dir, ChecksumFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return sums, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if _, err := hex.DecodeString(sum); !ok || err != nil || len(sum) != 2*sha256.Size || name == "" {
+			*issues = append(*issues, CacheIssue{IssueUnreadableFile, fmt.Sprintf("%v: malformed line %d", f.Name(), line)})
+			continue
+		}
+		sums[name] = sum
+	}
+	return sums, scanner.Err()
+}
+
+func fileChecksum(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,85 @@
+package fetch
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCache(t *testing.T) {
+	key := newTestKey(t)
+	client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+	for number := uint64(10); number < 14; number++ {
+		client.blocks[number] = testBatcherBlock(t, key, number)
+	}
+	fetch := func(t *testing.T) Config {
+		config := Config{
+			Start:              10,
+			End:                14,
+			ChainID:            testChainID,
+			BatchInbox:         testInbox,
+			BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+			OutDirectory:       t.TempDir(),
+			ConcurrentRequests: 2,
+			BlocksPerDirectory: 2,
+		}
+		Batches(client, nil, config)
+		return config
+	}
+	cacheFile := func(config Config, number uint64) string {
+		return CacheFilePath(config.OutDirectory, config.BlocksPerDirectory, number, client.blocks[number].Transactions()[0].Hash())
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		config := fetch(t)
+		require.FileExists(t, path.Join(path.Dir(cacheFile(config, 10)), ChecksumFile))
+		issues, err := VerifyCache(config.OutDirectory)
+		require.NoError(t, err)
+		require.Empty(t, issues)
+		// The checksum files are not mistaken for cached transactions.
+		issues, err = ValidateCache(config.OutDirectory)
+		require.NoError(t, err)
+		require.Empty(t, issues)
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		config := fetch(t)
+		truncated := cacheFile(config, 11)
+		data, err := os.ReadFile(truncated)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(truncated, data[:len(data)/2], 0644))
+		missing := cacheFile(config, 12)
+		require.NoError(t, os.Remove(missing))
+		unlisted := path.Join(path.Dir(missing), "unlisted.json")
+		require.NoError(t, os.WriteFile(unlisted, data, 0644))
+
+		issues, err := VerifyCache(config.OutDirectory)
+		require.NoError(t, err)
+		require.Len(t, issues, 3)
+		kinds := make(map[CacheIssueKind]string)
+		for _, issue := range issues {
+			kinds[issue.Kind] = issue.Detail
+		}
+		require.Contains(t, kinds[IssueChecksumMismatch], truncated)
+		require.Contains(t, kinds[IssueMissingFile], missing)
+		require.Contains(t, kinds[IssueMissingChecksum], unlisted)
+	})
+
+	t.Run("MalformedChecksumFile", func(t *testing.T) {
+		config := fetch(t)
+		sums := path.Join(path.Dir(cacheFile(config, 10)), ChecksumFile)
+		f, err := os.OpenFile(sums, os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = f.WriteString("not a checksum\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		issues, err := VerifyCache(config.OutDirectory)
+		require.NoError(t, err)
+		require.Equal(t, []CacheIssue{{IssueUnreadableFile, sums + ": malformed line 3"}}, issues)
+	})
+}
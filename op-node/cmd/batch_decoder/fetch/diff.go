@@ -0,0 +1,160 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// CacheDiff describes the differences between two transaction caches A and B.
+type CacheDiff struct {
+	// Identical is the number of transactions which are cached byte for byte the same in both caches.
+	Identical int         `json:"identical"`
+	OnlyA     []DiffEntry `json:"only_a"`
+	OnlyB     []DiffEntry `json:"only_b"`
+	Different []DiffEntry `json:"different"`
+	// Unreadable lists the files of either cache which can't be decoded, and are not compared.
+	Unreadable []string `json:"unreadable"`
+}
+
+// DiffEntry is a cached transaction which is missing from, or differs between, the caches.
+type DiffEntry struct {
+	Block  uint64      `json:"block"`
+	TxHash common.Hash `json:"tx_hash"`
+	// Fields are the JSON fields of the cached transaction which differ, for transactions in both caches.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Equal reports whether both caches hold the same transactions with the same contents.
+func (d CacheDiff) Equal() bool {
+	return len(d.OnlyA) == 0 && len(d.OnlyB) == 0 && len(d.Different) == 0 && len(d.Unreadable) == 0
+}
+
+// diffFile is a cached transaction file indexed for the comparison.
+type diffFile struct {
+	file  string
+	block uint64
+	sum   [32]byte
+}
+
+// DiffCaches compares the transaction caches in the directories a and b. Transactions are matched by
+// hash, so caches with a different directory layout can be compared.
+func DiffCaches(a, b string) (CacheDiff, error) {
+	var diff CacheDiff
+	filesA, filesB := make(map[common.Hash]diffFile), make(map[common.Hash]diffFile)
+	if err := indexCacheDir(a, filesA, &diff.Unreadable); err != nil {
+		return diff, err
+	}
+	if err := indexCacheDir(b, filesB, &diff.Unreadable); err != nil {
+		return diff, err
+	}
+	for hash, fa := range filesA {
+		fb, ok := filesB[hash]
+		if !ok {
+			diff.OnlyA = append(diff.OnlyA, DiffEntry{Block: fa.block, TxHash: hash})
+			continue
+		}
+		if fa.sum == fb.sum {
+			diff.Identical++
+			continue
+		}
+		fields, err := diffFields(fa.file, fb.file)
+		if err != nil {
+			return diff, err
+		}
+		diff.Different = append(diff.Different, DiffEntry{Block: fa.block, TxHash: hash, Fields: fields})
+	}
+	for hash, fb := range filesB {
+		if _, ok := filesA[hash]; !ok {
+			diff.OnlyB = append(diff.OnlyB, DiffEntry{Block: fb.block, TxHash: hash})
+		}
+	}
+	for _, entries := range [][]DiffEntry{diff.OnlyA, diff.OnlyB, diff.Different} {
+		sortDiffEntries(entries)
+	}
+	sort.Strings(diff.Unreadable)
+	return diff, nil
+}
+
+func sortDiffEntries(entries []DiffEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Block != entries[j].Block {
+			return entries[i].Block < entries[j].Block
+		}
+		return bytes.Compare(entries[i].TxHash[:], entries[j].TxHash[:]) < 0
+	})
+}
+
+// indexCacheDir records the block and content hash of every cached transaction of dir by transaction hash.
+func indexCacheDir(dir string, files map[common.Hash]diffFile, unreadable *[]string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		f := path.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if err := indexCacheDir(f, files, unreadable); err != nil {
+				return err
+			}
+			continue
+		}
+		if IsMetadataFile(entry.Name()) || path.Ext(f) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		var txm TransactionWithMetadata
+		if err := json.Unmarshal(data, &txm); err != nil || txm.Tx == nil {
+			*unreadable = append(*unreadable, f)
+			continue
+		}
+		files[txm.Tx.Hash()] = diffFile{file: f, block: txm.BlockNumber, sum: sha256.Sum256(data)}
+	}
+	return nil
+}
+
+// diffFields returns the sorted names of the top level JSON fields which differ between two cache files.
+func diffFields(a, b string) ([]string, error) {
+	fieldsA, err := readFields(a)
+	if err != nil {
+		return nil, err
+	}
+	fieldsB, err := readFields(b)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for name, va := range fieldsA {
+		if vb, ok := fieldsB[name]; !ok || !bytes.Equal(va, vb) {
+			out = append(out, name)
+		}
+	}
+	for name := range fieldsB {
+		if _, ok := fieldsA[name]; !ok {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func readFields(file string) (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode %v: %w", file, err)
+	}
+	return fields, nil
+}
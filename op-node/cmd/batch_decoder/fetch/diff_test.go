@@ -0,0 +1,69 @@
+package fetch
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffCaches(t *testing.T) {
+	key := newTestKey(t)
+	client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+	for number := uint64(10); number < 14; number++ {
+		client.blocks[number] = testBatcherBlock(t, key, number)
+	}
+	fetch := func(t *testing.T, end, blocksPerDir uint64) string {
+		config := Config{
+			Start:              10,
+			End:                end,
+			ChainID:            testChainID,
+			BatchInbox:         testInbox,
+			BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+			OutDirectory:       t.TempDir(),
+			ConcurrentRequests: 2,
+			BlocksPerDirectory: blocksPerDir,
+		}
+		Batches(client, nil, config)
+		return config.OutDirectory
+	}
+	txHash := func(number uint64) common.Hash {
+		return client.blocks[number].Transactions()[0].Hash()
+	}
+
+	t.Run("Equal", func(t *testing.T) {
+		// The directory layout doesn't matter.
+		diff, err := DiffCaches(fetch(t, 14, 0), fetch(t, 14, 2))
+		require.NoError(t, err)
+		require.True(t, diff.Equal())
+		require.Equal(t, 4, diff.Identical)
+	})
+
+	t.Run("Different", func(t *testing.T) {
+		a, b := fetch(t, 14, 0), fetch(t, 13, 0)
+		// Flag the transaction of block 11 as invalid in b.
+		file := CacheFilePath(b, 0, 11, txHash(11))
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		var txm TransactionWithMetadata
+		require.NoError(t, json.Unmarshal(data, &txm))
+		txm.ValidSender = false
+		data, err = json.Marshal(txm)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(file, data, 0644))
+		require.NoError(t, os.WriteFile(path.Join(b, "corrupt.json"), []byte("{"), 0644))
+
+		diff, err := DiffCaches(a, b)
+		require.NoError(t, err)
+		require.False(t, diff.Equal())
+		require.Equal(t, 2, diff.Identical)
+		require.Equal(t, []DiffEntry{{Block: 13, TxHash: txHash(13)}}, diff.OnlyA)
+		require.Empty(t, diff.OnlyB)
+		require.Equal(t, []DiffEntry{{Block: 11, TxHash: txHash(11), Fields: []string{"valid_sender"}}}, diff.Different)
+		require.Equal(t, []string{path.Join(b, "corrupt.json")}, diff.Unreadable)
+	})
+}
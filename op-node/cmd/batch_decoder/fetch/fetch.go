@@ -1,24 +1,30 @@
 package fetch
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
 	"os"
 	"path"
+	"sort"
 	"sync/atomic"
 	"time"
 
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/metrics"
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
 	"github.com/ethereum-optimism/optimism/op-service/eth"
 	"github.com/ethereum-optimism/optimism/op-service/sources"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
 type TransactionWithMetadata struct {
@@ -36,6 +42,11 @@ type TransactionWithMetadata struct {
 	Tx          *types.Transaction `json:"tx"`
 }
 
+// L1Client is the subset of the L1 execution client used to fetch blocks.
+type L1Client interface {
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+}
+
 type Config struct {
 	Start, End         uint64
 	ChainID            *big.Int
@@ -43,18 +54,170 @@ type Config struct {
 	BatchSenders       map[common.Address]struct{}
 	OutDirectory       string
 	ConcurrentRequests uint64
+	// BeaconConcurrentRequests limits the number of concurrent blob sidecar requests to the beacon node.
+	// Zero means blob requests are only bounded by ConcurrentRequests.
+	BeaconConcurrentRequests uint64
+	// Metrics records fetch progress. Defaults to no-op metrics when nil.
+	Metrics metrics.Metricer
+	// TxFilter, if set, is used to fetch only the transactions sent to the batch inbox instead of full blocks.
+	TxFilter InboxTxFetcher
+	// BlocksPerDirectory shards the cache into subdirectories which each hold the
+	// transactions of a bucket of this many L1 blocks. Zero keeps the flat layout.
+	BlocksPerDirectory uint64
+
+	// RequestsPerSecond limits the rate of requests to the L1 RPC, shared by all concurrent requests.
+	// Zero means requests are only bounded by ConcurrentRequests.
+	RequestsPerSecond float64
+
+	// MaxRetries is the number of times the fetch of a block is retried after a transient error,
+	// such as a timeout, a server error or rate limiting.
+	MaxRetries int
+
+	// BlobsOnly only caches the blob transactions sent to the batch inbox, skipping calldata batches.
+	BlobsOnly bool
+
+	// Channel, if not zero, restricts the cache to the transactions carrying a frame of this channel.
+	Channel derive.ChannelID
+
+	// ProgressInterval is the interval at which the progress of the fetch is printed. Zero disables it.
+	ProgressInterval time.Duration
+	// ProgressOutput is where the progress is printed to. Defaults to the log output.
+	ProgressOutput io.Writer
+	// Log receives the log output of the fetch, e.g. the fetched blocks and skipped transactions.
+	// Defaults to stdout.
+	Log io.Writer
+
+	// Resume skips the blocks of the range which a previous fetch into OutDirectory cached completely,
+	// according to its manifest.
+	Resume bool
+
+	// progress tracks the fetched blocks for the manifest, if set.
+	progress *progress
+	// channelFrames counts the frames found of the filtered channel, if set.
+	channelFrames *frameCounter
+	// limiter enforces RequestsPerSecond on the L1 requests, if set.
+	limiter *rate.Limiter
+}
+
+// Result summarizes a fetch run.
+type Result struct {
+	Start        uint64           `json:"start"`
+	End          uint64           `json:"end"`
+	ChainID      uint64           `json:"chain_id"`
+	BatchInbox   common.Address   `json:"batch_inbox"`
+	BatchSenders []common.Address `json:"batch_senders"`
+	TotalValid   uint64           `json:"total_valid"`
+	TotalInvalid uint64           `json:"total_invalid"`
+	OutDirectory string           `json:"out_directory"`
+	// SkippedBlocks is the number of blocks which were already cached when resuming.
+	SkippedBlocks uint64 `json:"skipped_blocks"`
+	// Channel is the channel the fetch was restricted to, and ChannelFrames the number of its frames found.
+	Channel       *derive.ChannelID `json:"channel,omitempty"`
+	ChannelFrames uint64            `json:"channel_frames,omitempty"`
+}
+
+func newResult(config Config, totalValid, totalInvalid uint64) Result {
+	return Result{
+		Start:         config.Start,
+		End:           config.End,
+		ChainID:       config.ChainID.Uint64(),
+		BatchInbox:    config.BatchInbox,
+		BatchSenders:  config.sortedSenders(),
+		TotalValid:    totalValid,
+		TotalInvalid:  totalInvalid,
+		OutDirectory:  config.OutDirectory,
+		Channel:       config.channelFilter(),
+		ChannelFrames: config.channelFrames.total(),
+	}
+}
+
+// sortedSenders returns the batch senders sorted by address.
+func (c Config) sortedSenders() []common.Address {
+	senders := make([]common.Address, 0, len(c.BatchSenders))
+	for sender := range c.BatchSenders {
+		senders = append(senders, sender)
+	}
+	sort.Slice(senders, func(i, j int) bool { return bytes.Compare(senders[i][:], senders[j][:]) < 0 })
+	return senders
+}
+
+// wantTx reports whether a transaction sent to the batch inbox should be cached.
+func (c Config) wantTx(tx *types.Transaction) bool {
+	return !c.BlobsOnly || tx.Type() == types.BlobTxType
+}
+
+// logOutput returns the writer the log output of the fetch is printed to.
+func (c Config) logOutput() io.Writer {
+	if c.Log == nil {
+		return os.Stdout
+	}
+	return c.Log
+}
+
+// CacheFilePath returns the path of the cache file for the given transaction.
+// When blocksPerDir is non-zero, the file is placed in a subdirectory named after
+// the L1 block range bucket that contains blockNumber.
+func CacheFilePath(dir string, blocksPerDir uint64, blockNumber uint64, txHash common.Hash) string {
+	filename := fmt.Sprintf("%s.json", txHash.String())
+	if blocksPerDir == 0 {
+		return path.Join(dir, filename)
+	}
+	bucketStart := blockNumber - blockNumber%blocksPerDir
+	shard := fmt.Sprintf("%d-%d", bucketStart, bucketStart+blocksPerDir-1)
+	return path.Join(dir, shard, filename)
 }
 
 // Batches fetches & stores all transactions sent to the batch inbox address in
 // the given block range (inclusive to exclusive).
 // The transactions & metadata are written to the out directory.
-func Batches(client *ethclient.Client, beacon *sources.L1BeaconClient, config Config) (totalValid, totalInvalid uint64) {
+func Batches(client L1Client, beacon *sources.L1BeaconClient, config Config) Result {
 	if err := os.MkdirAll(config.OutDirectory, 0750); err != nil {
 		log.Fatal(err)
 	}
+	if config.Metrics == nil {
+		config.Metrics = metrics.NoopMetrics
+	}
+	config.limiter = newLimiter(config.RequestsPerSecond)
+	config.progress = newProgress(config)
+	if config.channelFilter() != nil {
+		config.channelFrames = newFrameCounter()
+	}
+	var cached cachedRange
+	if config.Resume {
+		var err error
+		cached, err = resumeRange(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for block, count := range cached.counts {
+			config.progress.manifest.TxCounts[block] = count
+		}
+		config.progress.merge(cached.previous, config.Start, config.End)
+	}
 	signer := types.LatestSignerForChainID(config.ChainID)
 	concurrentRequests := int(config.ConcurrentRequests)
+	var blobs derive.L1BlobsFetcher
+	if beacon != nil {
+		blobs = newLimitedBlobsFetcher(beacon, config.BeaconConcurrentRequests)
+	}
 
+	var totalValid, totalInvalid, skipped uint64
+	var processed, lastBlock atomic.Uint64
+	if config.ProgressInterval > 0 {
+		start := time.Now()
+		total := config.End - config.Start
+		out := config.ProgressOutput
+		if out == nil {
+			out = config.logOutput()
+		}
+		stop := startProgressLog(config.ProgressInterval, func() {
+			done := processed.Load()
+			fmt.Fprintf(out, "Progress: %d/%d blocks (%.1f%%), last fetched block %d, %d valid & %d invalid batches, %v elapsed\n",
+				done, total, 100*float64(done)/float64(total), lastBlock.Load(),
+				atomic.LoadUint64(&totalValid), atomic.LoadUint64(&totalInvalid), time.Since(start).Truncate(time.Second))
+		})
+		defer stop()
+	}
 	g, ctx := errgroup.WithContext(context.Background())
 	g.SetLimit(concurrentRequests)
 
@@ -63,134 +226,235 @@ func Batches(client *ethclient.Client, beacon *sources.L1BeaconClient, config Co
 			break
 		}
 		number := i
+		if cached.contains(number) {
+			skipped++
+			processed.Add(1)
+			if err := config.progress.complete(number, config.OutDirectory); err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
 		g.Go(func() error {
-			valid, invalid, err := fetchBatchesPerBlock(ctx, client, beacon, number, signer, config)
+			valid, invalid, err := fetchBatchesPerBlockWithRetries(ctx, client, blobs, number, signer, config)
 			if err != nil {
 				return fmt.Errorf("error occurred while fetching block %d: %w", number, err)
 			}
+			config.Metrics.RecordBatches(valid, invalid)
 			atomic.AddUint64(&totalValid, valid)
 			atomic.AddUint64(&totalInvalid, invalid)
-			return nil
+			processed.Add(1)
+			lastBlock.Store(number)
+			return config.progress.complete(number, config.OutDirectory)
 		})
 	}
 	if err := g.Wait(); err != nil {
 		log.Fatal(err)
 	}
-	return
+	if err := WriteManifest(config.OutDirectory, config.progress.Manifest()); err != nil {
+		log.Fatal(err)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(config.logOutput(), "Skipped %v blocks which were already cached\n", skipped)
+	}
+	result := newResult(config, totalValid, totalInvalid)
+	result.SkippedBlocks = skipped
+	return result
 }
 
 // fetchBatchesPerBlock gets a block & the parses all of the transactions in the block.
-func fetchBatchesPerBlock(ctx context.Context, client *ethclient.Client, beacon *sources.L1BeaconClient, number uint64, signer types.Signer, config Config) (uint64, uint64, error) {
-	validBatchCount := uint64(0)
-	invalidBatchCount := uint64(0)
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	block, err := client.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+// If a transaction filter is configured, only the transactions sent to the batch inbox are fetched
+// instead of the full block, falling back to the full block when the filter can't be used.
+func fetchBatchesPerBlock(ctx context.Context, client L1Client, beacon derive.L1BlobsFetcher, number uint64, signer types.Signer, config Config) (uint64, uint64, error) {
+	if config.TxFilter != nil {
+		valid, invalid, ok, err := fetchFilteredBatchesPerBlock(ctx, beacon, number, signer, config)
+		if err != nil || ok {
+			return valid, invalid, err
+		}
+	}
+	reqCtx, cancel, err := config.requestContext(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	block, err := client.BlockByNumber(reqCtx, new(big.Int).SetUint64(number))
+	cancel()
 	if err != nil {
 		return 0, 0, err
 	}
-	fmt.Println("Fetched block: ", number)
+	fmt.Fprintln(config.logOutput(), "Fetched block: ", number)
+	config.Metrics.RecordBlockFetched()
+	validBatchCount := uint64(0)
+	invalidBatchCount := uint64(0)
+	ref := eth.L1BlockRef{
+		Hash:       block.Hash(),
+		Number:     block.NumberU64(),
+		ParentHash: block.ParentHash(),
+		Time:       block.Time(),
+	}
 	blobIndex := 0 // index of each blob in the block's blob sidecar
 	for i, tx := range block.Transactions() {
-		if tx.To() != nil && *tx.To() == config.BatchInbox {
-			sender, err := signer.Sender(tx)
+		if tx.To() != nil && *tx.To() == config.BatchInbox && config.wantTx(tx) {
+			valid, invalid, err := processBatchTx(ctx, beacon, ref, uint64(i), tx, blobIndex, signer, config)
 			if err != nil {
 				return 0, 0, err
 			}
-			validSender := true
-			if _, ok := config.BatchSenders[sender]; !ok {
-				fmt.Printf("Found a transaction (%s) from an invalid sender (%s)\n", tx.Hash().String(), sender.String())
-				invalidBatchCount += 1
-				validSender = false
-			}
-			var datas []hexutil.Bytes
-			if tx.Type() != types.BlobTxType {
-				datas = append(datas, tx.Data())
-				// no need to increment blobIndex because no blobs
-			} else {
-				if beacon == nil {
-					fmt.Printf("Unable to handle blob transaction (%s) because L1 Beacon API not provided\n", tx.Hash().String())
-					blobIndex += len(tx.BlobHashes())
-					continue
-				}
-				var hashes []eth.IndexedBlobHash
-				for _, h := range tx.BlobHashes() {
-					idh := eth.IndexedBlobHash{
-						Index: uint64(blobIndex),
-						Hash:  h,
-					}
-					hashes = append(hashes, idh)
-					blobIndex += 1
-				}
-				blobs, err := beacon.GetBlobs(ctx, eth.L1BlockRef{
-					Hash:       block.Hash(),
-					Number:     block.Number().Uint64(),
-					ParentHash: block.ParentHash(),
-					Time:       block.Time(),
-				}, hashes)
-				if err != nil {
-					log.Fatal(fmt.Errorf("failed to fetch blobs: %w", err))
-				}
-				for _, blob := range blobs {
-					data, err := blob.ToData()
-					if err != nil {
-						log.Fatal(fmt.Errorf("failed to parse blobs: %w", err))
-					}
-					datas = append(datas, data)
-				}
-			}
-			var frameErrors []string
-			var frames []derive.Frame
-			var validFrames []bool
-			validBatch := true
-			for _, data := range datas {
-				validFrame := true
-				frameError := ""
-				framesPerData, err := derive.ParseFrames(data)
-				if err != nil {
-					fmt.Printf("Found a transaction (%s) with invalid data: %v\n", tx.Hash().String(), err)
-					validFrame = false
-					validBatch = false
-					frameError = err.Error()
-				} else {
-					frames = append(frames, framesPerData...)
-				}
-				frameErrors = append(frameErrors, frameError)
-				validFrames = append(validFrames, validFrame)
-			}
-			if validSender && validBatch {
-				validBatchCount += 1
-			} else {
-				invalidBatchCount += 1
-			}
-			txm := &TransactionWithMetadata{
-				Tx:          tx,
-				Sender:      sender,
-				ValidSender: validSender,
-				TxIndex:     uint64(i),
-				BlockNumber: block.NumberU64(),
-				BlockHash:   block.Hash(),
-				BlockTime:   block.Time(),
-				ChainId:     config.ChainID.Uint64(),
-				InboxAddr:   config.BatchInbox,
-				Frames:      frames,
-				FrameErrs:   frameErrors,
-				ValidFrames: validFrames,
+			validBatchCount += valid
+			invalidBatchCount += invalid
+		}
+		blobIndex += len(tx.BlobHashes())
+	}
+	return validBatchCount, invalidBatchCount, nil
+}
+
+// fetchFilteredBatchesPerBlock fetches only the transactions sent to the batch inbox in the block.
+// It reports ok=false, without error, if the filter can't be used for this block and the caller
+// should fall back to scanning the full block. This is the case if the filter is unsupported by
+// the L1 provider, or if the block contains blob transactions to the inbox, since the index of a
+// blob in the block's sidecars can only be determined from all transactions of the block.
+func fetchFilteredBatchesPerBlock(ctx context.Context, beacon derive.L1BlobsFetcher, number uint64, signer types.Signer, config Config) (valid, invalid uint64, ok bool, err error) {
+	header, txs, err := config.TxFilter.InboxTransactions(ctx, config.requestContext, number, config.BatchInbox)
+	if err != nil {
+		if !errors.Is(err, ErrTxFilterUnsupported) {
+			fmt.Fprintf(config.logOutput(), "Failed to filter transactions of block %v, scanning full block: %v\n", number, err)
+		}
+		return 0, 0, false, nil
+	}
+	for _, tx := range txs {
+		if tx.Tx.Type() == types.BlobTxType {
+			return 0, 0, false, nil
+		}
+	}
+	fmt.Fprintln(config.logOutput(), "Fetched filtered block: ", number)
+	config.Metrics.RecordBlockFetched()
+	ref := eth.L1BlockRef{
+		Hash:       header.Hash(),
+		Number:     header.Number.Uint64(),
+		ParentHash: header.ParentHash,
+		Time:       header.Time,
+	}
+	for _, tx := range txs {
+		if !config.wantTx(tx.Tx) {
+			continue
+		}
+		v, i, err := processBatchTx(ctx, beacon, ref, tx.Index, tx.Tx, 0, signer, config)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		valid += v
+		invalid += i
+	}
+	return valid, invalid, true, nil
+}
+
+// processBatchTx parses the frames of a transaction sent to the batch inbox & writes it with its metadata
+// to the out directory. blobIndex is the index of the transaction's first blob in the block's blob sidecars.
+func processBatchTx(ctx context.Context, beacon derive.L1BlobsFetcher, ref eth.L1BlockRef, txIndex uint64, tx *types.Transaction, blobIndex int, signer types.Signer, config Config) (uint64, uint64, error) {
+	validBatchCount := uint64(0)
+	invalidBatchCount := uint64(0)
+	sender, err := signer.Sender(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	validSender := true
+	if _, ok := config.BatchSenders[sender]; !ok {
+		fmt.Fprintf(config.logOutput(), "Found a transaction (%s) from an invalid sender (%s)\n", tx.Hash().String(), sender.String())
+		invalidBatchCount += 1
+		validSender = false
+	}
+	var datas []hexutil.Bytes
+	if tx.Type() != types.BlobTxType {
+		datas = append(datas, tx.Data())
+	} else {
+		if beacon == nil {
+			fmt.Fprintf(config.logOutput(), "Unable to handle blob transaction (%s) because L1 Beacon API not provided\n", tx.Hash().String())
+			return validBatchCount, invalidBatchCount, nil
+		}
+		var hashes []eth.IndexedBlobHash
+		for _, h := range tx.BlobHashes() {
+			idh := eth.IndexedBlobHash{
+				Index: uint64(blobIndex),
+				Hash:  h,
 			}
-			filename := path.Join(config.OutDirectory, fmt.Sprintf("%s.json", tx.Hash().String()))
-			file, err := os.Create(filename)
+			hashes = append(hashes, idh)
+			blobIndex += 1
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		blobs, err := beacon.GetBlobs(reqCtx, ref, hashes)
+		cancel()
+		if err != nil {
+			return 0, 0, &blobFetchError{err: err}
+		}
+		for _, blob := range blobs {
+			data, err := blob.ToData()
 			if err != nil {
-				return 0, 0, err
-			}
-			enc := json.NewEncoder(file)
-			if err := enc.Encode(txm); err != nil {
-				file.Close()
-				return 0, 0, err
+				return 0, 0, fmt.Errorf("failed to parse blobs: %w", err)
 			}
-			file.Close()
+			datas = append(datas, data)
+		}
+	}
+	var frameErrors []string
+	var frames []derive.Frame
+	var validFrames []bool
+	validBatch := true
+	for _, data := range datas {
+		validFrame := true
+		frameError := ""
+		framesPerData, err := derive.ParseFrames(data)
+		if err != nil {
+			fmt.Fprintf(config.logOutput(), "Found a transaction (%s) with invalid data: %v\n", tx.Hash().String(), err)
+			config.Metrics.RecordDecodeError(metrics.ErrFrameParse)
+			validFrame = false
+			validBatch = false
+			frameError = err.Error()
 		} else {
-			blobIndex += len(tx.BlobHashes())
+			frames = append(frames, framesPerData...)
+		}
+		frameErrors = append(frameErrors, frameError)
+		validFrames = append(validFrames, validFrame)
+	}
+	if config.channelFilter() != nil {
+		n := countChannelFrames(frames, config.Channel)
+		if n == 0 {
+			return 0, 0, nil
 		}
+		config.channelFrames.add(ref.Number, n)
+	}
+	if validSender && validBatch {
+		validBatchCount += 1
+	} else {
+		invalidBatchCount += 1
+	}
+	txm := &TransactionWithMetadata{
+		Tx:          tx,
+		Sender:      sender,
+		ValidSender: validSender,
+		TxIndex:     txIndex,
+		BlockNumber: ref.Number,
+		BlockHash:   ref.Hash,
+		BlockTime:   ref.Time,
+		ChainId:     config.ChainID.Uint64(),
+		InboxAddr:   config.BatchInbox,
+		Frames:      frames,
+		FrameErrs:   frameErrors,
+		ValidFrames: validFrames,
+	}
+	filename := CacheFilePath(config.OutDirectory, config.BlocksPerDirectory, ref.Number, tx.Hash())
+	if err := os.MkdirAll(path.Dir(filename), 0750); err != nil {
+		return 0, 0, err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	h := sha256.New()
+	enc := json.NewEncoder(io.MultiWriter(file, h))
+	if err := enc.Encode(txm); err != nil {
+		file.Close()
+		return 0, 0, err
+	}
+	file.Close()
+	if err := appendChecksum(filename, h.Sum(nil)); err != nil {
+		return 0, 0, err
 	}
+	config.progress.record(ref.Number)
 	return validBatchCount, invalidBatchCount, nil
 }
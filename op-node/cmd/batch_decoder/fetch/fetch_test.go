@@ -0,0 +1,240 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/metrics"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheFilePath(t *testing.T) {
+	hash := common.Hash{0xaa}
+	name := hash.String() + ".json"
+
+	t.Run("Flat", func(t *testing.T) {
+		require.Equal(t, path.Join("/cache", name), CacheFilePath("/cache", 0, 1234, hash))
+	})
+
+	t.Run("Sharded", func(t *testing.T) {
+		require.Equal(t, path.Join("/cache", "1000-1999", name), CacheFilePath("/cache", 1000, 1000, hash))
+		require.Equal(t, path.Join("/cache", "1000-1999", name), CacheFilePath("/cache", 1000, 1999, hash))
+		require.Equal(t, path.Join("/cache", "2000-2999", name), CacheFilePath("/cache", 1000, 2000, hash))
+		require.Equal(t, path.Join("/cache", "0-99", name), CacheFilePath("/cache", 100, 5, hash))
+	})
+}
+
+var (
+	testChainID = big.NewInt(900)
+	testInbox   = common.Address{0xff, 0x10}
+)
+
+// testBatcherBlock builds an L1 block containing a single calldata batch transaction to the test inbox.
+func testBatcherBlock(t *testing.T, key testKey, number uint64) *types.Block {
+	var data []byte
+	data = append(data, derive.DerivationVersion0)
+	frame := derive.Frame{ID: derive.ChannelID{byte(number)}, Data: []byte{0x01}, IsLast: true}
+	data = append(data, frameBytes(t, frame)...)
+	tx := types.MustSignNewTx(key.priv, types.LatestSignerForChainID(testChainID), &types.DynamicFeeTx{
+		ChainID: testChainID,
+		Nonce:   number,
+		To:      &testInbox,
+		Data:    data,
+	})
+	header := &types.Header{Number: new(big.Int).SetUint64(number), Time: number * 12}
+	return types.NewBlock(header, &types.Body{Transactions: []*types.Transaction{tx}}, nil, trie.NewStackTrie(nil))
+}
+
+func frameBytes(t *testing.T, frame derive.Frame) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, frame.MarshalBinary(&buf))
+	return buf.Bytes()
+}
+
+type testKey struct {
+	priv *ecdsa.PrivateKey
+	addr common.Address
+}
+
+func newTestKey(t *testing.T) testKey {
+	priv, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	return testKey{priv: priv, addr: crypto.PubkeyToAddress(priv.PublicKey)}
+}
+
+type fakeL1Client struct {
+	blocks map[uint64]*types.Block
+	calls  atomic.Int64
+}
+
+func (f *fakeL1Client) BlockByNumber(_ context.Context, number *big.Int) (*types.Block, error) {
+	f.calls.Add(1)
+	block, ok := f.blocks[number.Uint64()]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return block, nil
+}
+
+type fakeBlobsFetcher struct {
+	data eth.Data
+}
+
+func (f *fakeBlobsFetcher) GetBlobs(_ context.Context, _ eth.L1BlockRef, hashes []eth.IndexedBlobHash) ([]*eth.Blob, error) {
+	blobs := make([]*eth.Blob, len(hashes))
+	for i := range hashes {
+		blobs[i] = new(eth.Blob)
+		if err := blobs[i].FromData(f.data); err != nil {
+			return nil, err
+		}
+	}
+	return blobs, nil
+}
+
+func TestFetchBlobsOnly(t *testing.T) {
+	key := newTestKey(t)
+	signer := types.LatestSignerForChainID(testChainID)
+	data := append([]byte{derive.DerivationVersion0}, frameBytes(t, derive.Frame{ID: derive.ChannelID{0x01}, IsLast: true})...)
+	calldataTx := types.MustSignNewTx(key.priv, signer, &types.DynamicFeeTx{
+		ChainID: testChainID,
+		Nonce:   0,
+		To:      &testInbox,
+		Data:    data,
+	})
+	blobTx := types.MustSignNewTx(key.priv, signer, &types.BlobTx{
+		ChainID:    uint256.MustFromBig(testChainID),
+		Nonce:      1,
+		To:         testInbox,
+		BlobHashes: []common.Hash{{0x01}},
+	})
+	client := &fakeL1Client{blocks: map[uint64]*types.Block{
+		10: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(10)}).WithBody(types.Body{Transactions: []*types.Transaction{calldataTx, blobTx}}),
+	}}
+	blobs := &fakeBlobsFetcher{data: data}
+
+	for _, blobsOnly := range []bool{false, true} {
+		config := Config{
+			ChainID:      testChainID,
+			BatchInbox:   testInbox,
+			BatchSenders: map[common.Address]struct{}{key.addr: {}},
+			OutDirectory: t.TempDir(),
+			Metrics:      metrics.NoopMetrics,
+			BlobsOnly:    blobsOnly,
+		}
+		valid, invalid, err := fetchBatchesPerBlock(context.Background(), client, blobs, 10, signer, config)
+		require.NoError(t, err)
+		require.Zero(t, invalid)
+		require.FileExists(t, CacheFilePath(config.OutDirectory, 0, 10, blobTx.Hash()))
+		if blobsOnly {
+			require.Equal(t, uint64(1), valid)
+			require.NoFileExists(t, CacheFilePath(config.OutDirectory, 0, 10, calldataTx.Hash()))
+		} else {
+			require.Equal(t, uint64(2), valid)
+			require.FileExists(t, CacheFilePath(config.OutDirectory, 0, 10, calldataTx.Hash()))
+		}
+	}
+}
+
+func TestFetchProgressLog(t *testing.T) {
+	var calls atomic.Int64
+	stop := startProgressLog(time.Millisecond, func() { calls.Add(1) })
+	require.Eventually(t, func() bool { return calls.Load() >= 2 }, time.Second, time.Millisecond)
+	stop()
+	n := calls.Load()
+	time.Sleep(5 * time.Millisecond)
+	require.Equal(t, n, calls.Load(), "no progress must be logged after stop")
+
+	key := newTestKey(t)
+	client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+	for number := uint64(10); number < 13; number++ {
+		client.blocks[number] = testBatcherBlock(t, key, number)
+	}
+	// Slow the fetch down so progress is logged before it completes.
+	var out, log bytes.Buffer
+	result := Batches(&slowL1Client{fakeL1Client: client, delay: 20 * time.Millisecond}, nil, Config{
+		Start:              10,
+		End:                13,
+		ChainID:            testChainID,
+		BatchInbox:         testInbox,
+		BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+		OutDirectory:       t.TempDir(),
+		ConcurrentRequests: 1,
+		ProgressInterval:   time.Millisecond,
+		ProgressOutput:     &out,
+		Log:                &log,
+	})
+	require.Equal(t, uint64(3), result.TotalValid)
+	require.Contains(t, log.String(), "Fetched block:  12")
+	require.NotContains(t, log.String(), "Progress:")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.NotEmpty(t, lines)
+	for _, line := range lines {
+		require.Regexp(t, `^Progress: [0-3]/3 blocks \(\d+\.\d%\), last fetched block \d+, \d valid & 0 invalid batches, \S+ elapsed$`, line)
+	}
+	require.Contains(t, out.String(), "Progress: 1/3 blocks (33.3%), last fetched block 10, 1 valid & 0 invalid batches")
+}
+
+// slowL1Client delays every block request.
+type slowL1Client struct {
+	*fakeL1Client
+	delay time.Duration
+}
+
+func (s *slowL1Client) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	time.Sleep(s.delay)
+	return s.fakeL1Client.BlockByNumber(ctx, number)
+}
+
+func TestFetchChannel(t *testing.T) {
+	key := newTestKey(t)
+	client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+	for number := uint64(10); number < 14; number++ {
+		client.blocks[number] = testBatcherBlock(t, key, number)
+	}
+	config := Config{
+		Start:              10,
+		End:                14,
+		ChainID:            testChainID,
+		BatchInbox:         testInbox,
+		BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+		OutDirectory:       t.TempDir(),
+		ConcurrentRequests: 2,
+		// The frames of each test block belong to the channel with the block number as ID.
+		Channel: derive.ChannelID{11},
+	}
+	result := Batches(client, nil, config)
+	require.Equal(t, uint64(1), result.TotalValid)
+	require.Equal(t, &config.Channel, result.Channel)
+	require.Equal(t, uint64(1), result.ChannelFrames)
+	for number := uint64(10); number < 14; number++ {
+		file := CacheFilePath(config.OutDirectory, 0, number, client.blocks[number].Transactions()[0].Hash())
+		if number == 11 {
+			require.FileExists(t, file)
+		} else {
+			require.NoFileExists(t, file)
+		}
+	}
+
+	m, err := LoadManifest(config.OutDirectory)
+	require.NoError(t, err)
+	require.Equal(t, &config.Channel, m.Channel)
+	config.Resume = true
+	config.Channel = derive.ChannelID{}
+	_, err = resumeRange(config)
+	require.ErrorContains(t, err, "channel filter")
+}
@@ -0,0 +1,120 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrTxFilterUnsupported is returned by an InboxTxFetcher if the L1 provider does not support filtering.
+var ErrTxFilterUnsupported = errors.New("transaction filtering not supported by L1 provider")
+
+// methodNotFoundCode is the JSON-RPC error code returned for unknown methods.
+const methodNotFoundCode = -32601
+
+// IndexedTx is a transaction together with its index in the block.
+type IndexedTx struct {
+	Index uint64
+	Tx    *types.Transaction
+}
+
+// InboxTxFetcher fetches only the transactions sent to the batch inbox in a block, which avoids
+// downloading & scanning all transactions of the block.
+// Every L1 request it makes must use a context returned by newRequest, which applies the rate limit and
+// timeout of a single request.
+type InboxTxFetcher interface {
+	InboxTransactions(ctx context.Context, newRequest RequestContext, number uint64, inbox common.Address) (*types.Header, []IndexedTx, error)
+}
+
+// TraceFilterFetcher finds the transactions sent to the batch inbox with the trace_filter RPC method,
+// and then fetches only those transactions.
+// trace_filter is served by Erigon, Nethermind and Reth, but not by Geth. Once the L1 provider
+// reports the method as unknown, all further calls return ErrTxFilterUnsupported.
+type TraceFilterFetcher struct {
+	client      *ethclient.Client
+	log         io.Writer
+	unsupported atomic.Bool
+}
+
+// NewTraceFilterFetcher returns a TraceFilterFetcher which prints to log once it falls back to full blocks.
+func NewTraceFilterFetcher(client *ethclient.Client, log io.Writer) *TraceFilterFetcher {
+	return &TraceFilterFetcher{client: client, log: log}
+}
+
+type traceFilterArgs struct {
+	FromBlock hexutil.Uint64   `json:"fromBlock"`
+	ToBlock   hexutil.Uint64   `json:"toBlock"`
+	ToAddress []common.Address `json:"toAddress"`
+}
+
+type trace struct {
+	Action struct {
+		To *common.Address `json:"to"`
+	} `json:"action"`
+	TraceAddress        []uint64    `json:"traceAddress"`
+	TransactionHash     common.Hash `json:"transactionHash"`
+	TransactionPosition uint64      `json:"transactionPosition"`
+	Type                string      `json:"type"`
+}
+
+func (f *TraceFilterFetcher) InboxTransactions(ctx context.Context, newRequest RequestContext, number uint64, inbox common.Address) (*types.Header, []IndexedTx, error) {
+	if f.unsupported.Load() {
+		return nil, nil, ErrTxFilterUnsupported
+	}
+	request := func(fn func(ctx context.Context) error) error {
+		reqCtx, cancel, err := newRequest(ctx)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		return fn(reqCtx)
+	}
+	var traces []trace
+	args := traceFilterArgs{FromBlock: hexutil.Uint64(number), ToBlock: hexutil.Uint64(number), ToAddress: []common.Address{inbox}}
+	err := request(func(ctx context.Context) error {
+		return f.client.Client().CallContext(ctx, &traces, "trace_filter", args)
+	})
+	if err != nil {
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == methodNotFoundCode {
+			fmt.Fprintln(f.log, "L1 provider does not support trace_filter, scanning full blocks")
+			f.unsupported.Store(true)
+			return nil, nil, ErrTxFilterUnsupported
+		}
+		return nil, nil, fmt.Errorf("failed to filter transactions: %w", err)
+	}
+	var header *types.Header
+	err = request(func(ctx context.Context) (err error) {
+		header, err = f.client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var txs []IndexedTx
+	for _, t := range traces {
+		// Only top-level calls are batch transactions, internal calls to the inbox are ignored by derivation.
+		if t.Type != "call" || len(t.TraceAddress) != 0 || t.Action.To == nil || *t.Action.To != inbox {
+			continue
+		}
+		var tx *types.Transaction
+		err := request(func(ctx context.Context) (err error) {
+			tx, _, err = f.client.TransactionByHash(ctx, t.TransactionHash)
+			return err
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch transaction %v: %w", t.TransactionHash, err)
+		}
+		txs = append(txs, IndexedTx{Index: t.TransactionPosition, Tx: tx})
+	}
+	return header, txs, nil
+}
@@ -0,0 +1,120 @@
+package fetch
+
+import (
+	"context"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTxFilter serves the inbox transactions of the blocks of a fakeL1Client. Like TraceFilterFetcher,
+// it makes one request to filter the block, one for its header and one per transaction.
+type fakeTxFilter struct {
+	client      *fakeL1Client
+	unsupported bool
+	requests    atomic.Int64
+}
+
+func (f *fakeTxFilter) InboxTransactions(ctx context.Context, newRequest RequestContext, number uint64, inbox common.Address) (*types.Header, []IndexedTx, error) {
+	if f.unsupported {
+		return nil, nil, ErrTxFilterUnsupported
+	}
+	request := func() error {
+		_, cancel, err := newRequest(ctx)
+		if err != nil {
+			return err
+		}
+		cancel()
+		f.requests.Add(1)
+		return nil
+	}
+	if err := request(); err != nil {
+		return nil, nil, err
+	}
+	block := f.client.blocks[number]
+	if err := request(); err != nil {
+		return nil, nil, err
+	}
+	var txs []IndexedTx
+	for i, tx := range block.Transactions() {
+		if tx.To() != nil && *tx.To() == inbox {
+			if err := request(); err != nil {
+				return nil, nil, err
+			}
+			txs = append(txs, IndexedTx{Index: uint64(i), Tx: tx})
+		}
+	}
+	return block.Header(), txs, nil
+}
+
+func TestFetchWithTxFilter(t *testing.T) {
+	key := newTestKey(t)
+	newClient := func() *fakeL1Client {
+		client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+		for number := uint64(10); number < 13; number++ {
+			client.blocks[number] = testBatcherBlock(t, key, number)
+		}
+		return client
+	}
+	newConfig := func(filter InboxTxFetcher) Config {
+		return Config{
+			Start:              10,
+			End:                13,
+			ChainID:            testChainID,
+			BatchInbox:         testInbox,
+			BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+			OutDirectory:       t.TempDir(),
+			ConcurrentRequests: 2,
+			TxFilter:           filter,
+		}
+	}
+	requireCached := func(t *testing.T, client *fakeL1Client, config Config) {
+		for number := config.Start; number < config.End; number++ {
+			tx := client.blocks[number].Transactions()[0]
+			require.FileExists(t, CacheFilePath(config.OutDirectory, 0, number, tx.Hash()))
+		}
+	}
+
+	t.Run("Filtered", func(t *testing.T) {
+		client := newClient()
+		config := newConfig(&fakeTxFilter{client: client})
+		result := Batches(client, nil, config)
+		require.Equal(t, uint64(3), result.TotalValid)
+		require.Zero(t, result.TotalInvalid)
+		require.Zero(t, client.calls.Load(), "full blocks must not be fetched")
+		require.Equal(t, []common.Address{key.addr}, result.BatchSenders)
+		require.Equal(t, config.OutDirectory, result.OutDirectory)
+		requireCached(t, client, config)
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		client := newClient()
+		config := newConfig(&fakeTxFilter{client: client, unsupported: true})
+		result := Batches(client, nil, config)
+		require.Equal(t, uint64(3), result.TotalValid)
+		require.Zero(t, result.TotalInvalid)
+		require.Equal(t, int64(3), client.calls.Load())
+		requireCached(t, client, config)
+	})
+
+	t.Run("FallbackOnBlobTx", func(t *testing.T) {
+		client := newClient()
+		blobTx := types.MustSignNewTx(key.priv, types.LatestSignerForChainID(testChainID), &types.BlobTx{
+			ChainID:    uint256.MustFromBig(testChainID),
+			To:         testInbox,
+			BlobHashes: []common.Hash{{0x01}},
+		})
+		header := &types.Header{Number: big.NewInt(11)}
+		client.blocks[11] = types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: []*types.Transaction{blobTx}})
+		config := newConfig(&fakeTxFilter{client: client})
+		result := Batches(client, nil, config)
+		require.Equal(t, uint64(2), result.TotalValid, "blob transactions are skipped without a beacon client")
+		require.Zero(t, result.TotalInvalid)
+		require.Equal(t, int64(1), client.calls.Load(), "only the block with the blob transaction is fetched in full")
+	})
+}
@@ -0,0 +1,99 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/metrics"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/sources"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// resubscribeDelay is the time to wait before resubscribing to new L1 heads after the subscription failed.
+var resubscribeDelay = 5 * time.Second
+
+// HeadSubscriber subscribes to new L1 heads, e.g. an ethclient connected over websocket.
+type HeadSubscriber interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+}
+
+// Follow fetches & stores the batches of every L1 block from config.Start onwards as new heads arrive
+// on the subscription, until config.End (exclusive) is reached or the context is canceled. An End of zero
+// follows the chain indefinitely.
+// When the subscription drops, Follow resubscribes and backfills the blocks missed while disconnected
+// before processing the new head.
+// Follow doesn't handle L1 reorgs: every block is fetched once by number, when its head first arrives.
+// It writes no manifest, so config.Resume and config.ProgressInterval are ignored.
+func Follow(ctx context.Context, client L1Client, subscriber HeadSubscriber, beacon *sources.L1BeaconClient, config Config) (Result, error) {
+	if config.Metrics == nil {
+		config.Metrics = metrics.NoopMetrics
+	}
+	config.limiter = newLimiter(config.RequestsPerSecond)
+	if config.channelFilter() != nil {
+		config.channelFrames = newFrameCounter()
+	}
+	var blobs derive.L1BlobsFetcher
+	if beacon != nil {
+		blobs = newLimitedBlobsFetcher(beacon, config.BeaconConcurrentRequests)
+	}
+	totalValid, totalInvalid, err := follow(ctx, client, subscriber, blobs, config)
+	return newResult(config, totalValid, totalInvalid), err
+}
+
+func follow(ctx context.Context, client L1Client, subscriber HeadSubscriber, blobs derive.L1BlobsFetcher, config Config) (totalValid, totalInvalid uint64, err error) {
+	signer := types.LatestSignerForChainID(config.ChainID)
+	next := config.Start
+	done := func() bool { return config.End != 0 && next >= config.End }
+
+	for !done() {
+		heads := make(chan *types.Header, 16)
+		sub, err := subscriber.SubscribeNewHead(ctx, heads)
+		if err != nil {
+			fmt.Fprintf(config.logOutput(), "Failed to subscribe to new L1 heads: %v\n", err)
+			if !sleepCtx(ctx, resubscribeDelay) {
+				return totalValid, totalInvalid, nil
+			}
+			continue
+		}
+	recv:
+		for !done() {
+			select {
+			case head := <-heads:
+				for ; next <= head.Number.Uint64() && !done(); next++ {
+					valid, invalid, err := fetchBatchesPerBlockWithRetries(ctx, client, blobs, next, signer, config)
+					if err != nil {
+						sub.Unsubscribe()
+						return totalValid, totalInvalid, fmt.Errorf("error occurred while fetching block %d: %w", next, err)
+					}
+					config.Metrics.RecordBatches(valid, invalid)
+					totalValid += valid
+					totalInvalid += invalid
+				}
+			case err := <-sub.Err():
+				fmt.Fprintf(config.logOutput(), "L1 head subscription dropped, resubscribing: %v\n", err)
+				break recv
+			case <-ctx.Done():
+				sub.Unsubscribe()
+				return totalValid, totalInvalid, nil
+			}
+		}
+		sub.Unsubscribe()
+		if !done() && !sleepCtx(ctx, resubscribeDelay) {
+			return totalValid, totalInvalid, nil
+		}
+	}
+	return totalValid, totalInvalid, nil
+}
+
+// sleepCtx waits for the given duration and reports whether the context is still live afterwards.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
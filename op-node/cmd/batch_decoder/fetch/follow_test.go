@@ -0,0 +1,85 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSubscription struct {
+	errs chan error
+}
+
+func (s *fakeSubscription) Err() <-chan error { return s.errs }
+func (s *fakeSubscription) Unsubscribe()      {}
+
+// fakeHeadSubscriber replays one scripted session of heads per subscription, optionally
+// ending the session with a subscription error.
+type fakeHeadSubscriber struct {
+	sessions [][]uint64
+	dropErr  []error
+	count    int
+}
+
+func (f *fakeHeadSubscriber) SubscribeNewHead(_ context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	if f.count >= len(f.sessions) {
+		return nil, errors.New("no more sessions")
+	}
+	session, dropErr := f.sessions[f.count], f.dropErr[f.count]
+	f.count++
+	sub := &fakeSubscription{errs: make(chan error, 1)}
+	go func() {
+		for _, number := range session {
+			ch <- &types.Header{Number: new(big.Int).SetUint64(number)}
+		}
+		if dropErr != nil {
+			sub.errs <- dropErr
+		}
+	}()
+	return sub, nil
+}
+
+func TestFollowBackfillsAfterReconnect(t *testing.T) {
+	resubscribeDelay = 0
+	key := newTestKey(t)
+	client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+	for number := uint64(10); number < 20; number++ {
+		client.blocks[number] = testBatcherBlock(t, key, number)
+	}
+	subscriber := &fakeHeadSubscriber{
+		// The first session drops after block 11, and the second one resumes at block 14,
+		// so blocks 12 and 13 must be backfilled.
+		sessions: [][]uint64{{10, 11}, {14, 15}},
+		dropErr:  []error{errors.New("websocket closed"), nil},
+	}
+	dir := t.TempDir()
+	config := Config{
+		Start:        10,
+		End:          15,
+		ChainID:      testChainID,
+		BatchInbox:   testInbox,
+		BatchSenders: map[common.Address]struct{}{key.addr: {}},
+		OutDirectory: dir,
+	}
+
+	result, err := Follow(context.Background(), client, subscriber, nil, config)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), result.TotalValid)
+	require.Zero(t, result.TotalInvalid)
+	require.Equal(t, 2, subscriber.count)
+	for number := uint64(10); number < 15; number++ {
+		tx := client.blocks[number].Transactions()[0]
+		require.FileExists(t, CacheFilePath(dir, 0, number, tx.Hash()))
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 6, "blocks past the end must not be fetched")
+	require.Equal(t, ChecksumFile, entries[5].Name())
+}
@@ -0,0 +1,181 @@
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ManifestFile is the name of the file in the cache directory describing the fetched range.
+const ManifestFile = "manifest.json"
+
+// Manifest describes the L1 block range and configuration a transaction cache was fetched with.
+// Batches checkpoints it while fetching, so the range [Start, End) only covers the blocks which are
+// completely cached, and it covers the whole fetched range once Batches completes.
+type Manifest struct {
+	Start      uint64         `json:"start"`
+	End        uint64         `json:"end"`
+	ChainID    uint64         `json:"chain_id"`
+	BatchInbox common.Address `json:"batch_inbox"`
+	// BatchSenders are the sorted batcher addresses whose transactions were cached as valid.
+	BatchSenders       []common.Address `json:"batch_senders"`
+	BlocksPerDirectory uint64           `json:"blocks_per_directory"`
+	BlobsOnly          bool             `json:"blobs_only,omitempty"`
+	// Channel is the channel the cache is restricted to, if any.
+	Channel *derive.ChannelID `json:"channel,omitempty"`
+	// Timestamp is the unix time at which the manifest was written.
+	Timestamp uint64 `json:"timestamp"`
+	// TxCounts holds the number of cached transactions of each L1 block of the range which has any.
+	TxCounts map[uint64]uint64 `json:"tx_counts"`
+}
+
+// WriteManifest writes the manifest to the cache directory.
+// The file is replaced atomically, so an interrupted fetch never leaves a partial manifest.
+func WriteManifest(dir string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path.Join(dir, ManifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path.Join(dir, ManifestFile))
+}
+
+// LoadManifest reads the manifest of the cache directory.
+func LoadManifest(dir string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(path.Join(dir, ManifestFile))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return m, nil
+}
+
+// checkpointInterval is the number of completely fetched blocks after which the manifest is checkpointed.
+const checkpointInterval = 100
+
+// progress tracks the blocks fetched by Batches and the number of cached transactions per block
+// for the manifest.
+type progress struct {
+	mu       sync.Mutex
+	manifest Manifest
+	done     map[uint64]struct{}
+	// next is the first block which is not fetched yet, all blocks in [manifest.Start, next) are.
+	next           uint64
+	lastCheckpoint uint64
+	// [tailStart, tailEnd) are the blocks after the fetched range which a previous fetch cached, if any.
+	tailStart, tailEnd uint64
+}
+
+func newProgress(config Config) *progress {
+	return &progress{
+		manifest: Manifest{
+			Start:              config.Start,
+			ChainID:            config.ChainID.Uint64(),
+			BatchInbox:         config.BatchInbox,
+			BatchSenders:       config.sortedSenders(),
+			BlocksPerDirectory: config.BlocksPerDirectory,
+			BlobsOnly:          config.BlobsOnly,
+			Channel:            config.channelFilter(),
+			TxCounts:           make(map[uint64]uint64),
+		},
+		done:           make(map[uint64]struct{}),
+		next:           config.Start,
+		lastCheckpoint: config.Start,
+	}
+}
+
+// merge extends the manifest by the blocks outside of the fetched range [start, end) which the manifest
+// of a previous fetch into the same directory covers. The previous range must overlap with or adjoin the
+// fetched range, so the merged manifest still describes a contiguous range.
+func (p *progress) merge(prev Manifest, start, end uint64) {
+	if prev.Start >= prev.End {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.manifest.Start = min(p.manifest.Start, prev.Start)
+	if prev.End > end {
+		p.tailStart, p.tailEnd = end, prev.End
+	}
+	for block, count := range prev.TxCounts {
+		if block < start || block >= end {
+			p.manifest.TxCounts[block] = count
+		}
+	}
+}
+
+// record counts a cached transaction of the given block.
+func (p *progress) record(block uint64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.manifest.TxCounts[block]++
+}
+
+// reset discards the recorded transactions of a block before it is fetched again.
+func (p *progress) reset(block uint64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.manifest.TxCounts, block)
+}
+
+// complete marks a block, whose transactions are all recorded, as fetched. The manifest of the
+// completely fetched blocks is checkpointed to dir after every checkpointInterval blocks.
+func (p *progress) complete(block uint64, dir string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[block] = struct{}{}
+	for {
+		if _, ok := p.done[p.next]; !ok {
+			break
+		}
+		delete(p.done, p.next)
+		p.next++
+	}
+	if p.next == p.tailStart && p.tailEnd > p.next {
+		p.next = p.tailEnd
+	}
+	if p.next-p.lastCheckpoint < checkpointInterval {
+		return nil
+	}
+	p.lastCheckpoint = p.next
+	return WriteManifest(dir, p.snapshot())
+}
+
+// snapshot returns the manifest of the completely fetched blocks. The lock must be held.
+func (p *progress) snapshot() Manifest {
+	m := p.manifest
+	m.End = p.next
+	m.Timestamp = uint64(time.Now().Unix())
+	m.TxCounts = make(map[uint64]uint64)
+	for block, count := range p.manifest.TxCounts {
+		if block < p.next {
+			m.TxCounts[block] = count
+		}
+	}
+	return m
+}
+
+// Manifest returns the manifest of the completely fetched blocks.
+func (p *progress) Manifest() Manifest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snapshot()
+}
@@ -0,0 +1,46 @@
+package fetch
+
+import (
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ExpandOutDirectory expands the template variables {chainID}, {start} and {end} in the output directory,
+// so that caches of different chains and ranges are not accidentally mixed in a single directory.
+// Unknown or unterminated template variables are rejected.
+func ExpandOutDirectory(template string, chainID *big.Int, start, end uint64) (string, error) {
+	vars := map[string]string{
+		"chainID": chainID.String(),
+		"start":   strconv.FormatUint(start, 10),
+		"end":     strconv.FormatUint(end, 10),
+	}
+	var out strings.Builder
+	rest := template
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			out.WriteString(rest)
+			break
+		}
+		closing := strings.IndexByte(rest[open:], '}')
+		if closing < 0 {
+			return "", fmt.Errorf("unterminated template variable in output directory %q", template)
+		}
+		name := rest[open+1 : open+closing]
+		value, ok := vars[name]
+		if !ok {
+			return "", fmt.Errorf("unknown template variable {%s} in output directory %q", name, template)
+		}
+		out.WriteString(rest[:open])
+		out.WriteString(value)
+		rest = rest[open+closing+1:]
+	}
+	dir := filepath.Clean(out.String())
+	if strings.ContainsAny(dir, "{}") {
+		return "", fmt.Errorf("invalid output directory %q", dir)
+	}
+	return dir, nil
+}
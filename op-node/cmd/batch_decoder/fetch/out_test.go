@@ -0,0 +1,39 @@
+package fetch
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandOutDirectory(t *testing.T) {
+	dir, err := ExpandOutDirectory("/data/{chainID}/{start}-{end}", big.NewInt(10), 100, 200)
+	require.NoError(t, err)
+	require.Equal(t, "/data/10/100-200", dir)
+
+	dir, err = ExpandOutDirectory("/tmp/batch_decoder/transactions_cache", big.NewInt(10), 100, 200)
+	require.NoError(t, err)
+	require.Equal(t, "/tmp/batch_decoder/transactions_cache", dir, "directories without variables are unchanged")
+
+	t.Run("AvoidsCollisions", func(t *testing.T) {
+		const template = "/data/{chainID}/{start}-{end}"
+		a, err := ExpandOutDirectory(template, big.NewInt(10), 100, 200)
+		require.NoError(t, err)
+		b, err := ExpandOutDirectory(template, big.NewInt(8453), 100, 200)
+		require.NoError(t, err)
+		c, err := ExpandOutDirectory(template, big.NewInt(10), 200, 300)
+		require.NoError(t, err)
+		require.NotEqual(t, a, b)
+		require.NotEqual(t, a, c)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := ExpandOutDirectory("/data/{chain}", big.NewInt(10), 100, 200)
+		require.ErrorContains(t, err, "unknown template variable {chain}")
+		_, err = ExpandOutDirectory("/data/{start", big.NewInt(10), 100, 200)
+		require.ErrorContains(t, err, "unterminated template variable")
+		_, err = ExpandOutDirectory("/data/}{start}", big.NewInt(10), 100, 200)
+		require.ErrorContains(t, err, "invalid output directory")
+	})
+}
@@ -0,0 +1,32 @@
+package fetch
+
+import (
+	"sync"
+	"time"
+)
+
+// startProgressLog calls report every interval until the returned stop function is called.
+// Workers report their progress through atomic counters which report reads, so logging doesn't
+// contend with them on a lock.
+func startProgressLog(interval time.Duration, report func()) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,37 @@
+package fetch
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// requestTimeout bounds every single L1 or beacon request. For rate-limited requests it only starts once
+// the limiter allows the request, so queueing for the limiter never counts against it.
+var requestTimeout = 10 * time.Second
+
+// newLimiter returns the limiter shared by all L1 requests of a fetch, allowing at most rps requests
+// per second. Zero leaves requests unlimited and returns nil.
+func newLimiter(rps float64) *rate.Limiter {
+	if rps == 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(rps), 1)
+}
+
+// RequestContext returns the context for a single L1 request derived from ctx, after waiting for the
+// rate limit of the fetch. The returned cancel function must be called once the request completes.
+type RequestContext func(ctx context.Context) (context.Context, context.CancelFunc, error)
+
+// requestContext waits until the rate limit allows another L1 request and returns the context for the
+// request, bounded by requestTimeout. The wait itself is only bounded by ctx.
+func (c Config) requestContext(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	return ctx, cancel, nil
+}
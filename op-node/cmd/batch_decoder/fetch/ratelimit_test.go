@@ -0,0 +1,87 @@
+package fetch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestsPerSecond(t *testing.T) {
+	key := newTestKey(t)
+	client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+	for number := uint64(10); number < 16; number++ {
+		client.blocks[number] = testBatcherBlock(t, key, number)
+	}
+	config := Config{
+		Start:              10,
+		End:                16,
+		ChainID:            testChainID,
+		BatchInbox:         testInbox,
+		BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+		OutDirectory:       t.TempDir(),
+		ConcurrentRequests: 6,
+		RequestsPerSecond:  50,
+	}
+	start := time.Now()
+	result := Batches(client, nil, config)
+	// The limiter is shared by all workers: after the first request, one request is allowed every 20ms.
+	require.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	require.Equal(t, uint64(6), result.TotalValid)
+	require.Equal(t, int64(6), client.calls.Load())
+}
+
+func TestRequestsPerSecondQueueExceedsTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { requestTimeout = timeout }(requestTimeout)
+	requestTimeout = 20 * time.Millisecond
+
+	key := newTestKey(t)
+	client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+	for number := uint64(10); number < 20; number++ {
+		client.blocks[number] = testBatcherBlock(t, key, number)
+	}
+	config := Config{
+		Start:              10,
+		End:                20,
+		ChainID:            testChainID,
+		BatchInbox:         testInbox,
+		BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+		OutDirectory:       t.TempDir(),
+		ConcurrentRequests: 10,
+		// The last of the concurrent requests queues for about 180ms, far longer than the request timeout.
+		RequestsPerSecond: 50,
+		MaxRetries:        0,
+	}
+	result := Batches(client, nil, config)
+	require.Equal(t, uint64(10), result.TotalValid)
+	require.Equal(t, int64(10), client.calls.Load(), "no request must time out while queueing")
+}
+
+func TestRequestsPerSecondTxFilter(t *testing.T) {
+	key := newTestKey(t)
+	client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+	for number := uint64(10); number < 13; number++ {
+		client.blocks[number] = testBatcherBlock(t, key, number)
+	}
+	filter := &fakeTxFilter{client: client}
+	config := Config{
+		Start:              10,
+		End:                13,
+		ChainID:            testChainID,
+		BatchInbox:         testInbox,
+		BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+		OutDirectory:       t.TempDir(),
+		ConcurrentRequests: 3,
+		RequestsPerSecond:  50,
+		TxFilter:           filter,
+	}
+	start := time.Now()
+	result := Batches(client, nil, config)
+	// Every filtered block takes three requests, each of which is rate limited.
+	require.Equal(t, int64(9), filter.requests.Load())
+	require.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	require.Equal(t, uint64(3), result.TotalValid)
+	require.Zero(t, client.calls.Load())
+}
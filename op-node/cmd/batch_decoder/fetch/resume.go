@@ -0,0 +1,131 @@
+package fetch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// cachedRange describes the blocks a previous fetch into the out directory cached completely.
+type cachedRange struct {
+	start, end uint64
+	// counts holds the number of cached transactions of each block of the range which has any.
+	counts map[uint64]uint64
+	// stale holds the blocks of the range whose cached transactions are missing or corrupt.
+	stale map[uint64]struct{}
+	// previous is the manifest of the previous fetch, which is merged into the new one.
+	previous Manifest
+}
+
+func (c cachedRange) contains(block uint64) bool {
+	if block < c.start || block >= c.end {
+		return false
+	}
+	_, stale := c.stale[block]
+	return !stale
+}
+
+// resumeRange determines the blocks of the configured range which a previous fetch into the out
+// directory already cached completely, according to its manifest. A block is only considered cached
+// if all of its transactions recorded in the manifest are present and readable. Corrupt cache files,
+// e.g. of an interrupted write, are removed so their block is fetched again.
+// The range of the previous fetch must overlap with or adjoin the configured range, so the manifest can
+// be extended to cover both.
+func resumeRange(config Config) (cachedRange, error) {
+	m, err := LoadManifest(config.OutDirectory)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cachedRange{}, nil
+	} else if err != nil {
+		return cachedRange{}, err
+	}
+	if m.ChainID != config.ChainID.Uint64() || m.BatchInbox != config.BatchInbox || m.BlocksPerDirectory != config.BlocksPerDirectory ||
+		m.BlobsOnly != config.BlobsOnly {
+		return cachedRange{}, fmt.Errorf("cannot resume, %v was fetched for chain %d, inbox %v, %d blocks per directory and blobs only %v",
+			config.OutDirectory, m.ChainID, m.BatchInbox, m.BlocksPerDirectory, m.BlobsOnly)
+	}
+	// Manifests of older versions don't record the senders.
+	if m.BatchSenders != nil && !slices.Equal(m.BatchSenders, config.sortedSenders()) {
+		return cachedRange{}, fmt.Errorf("cannot resume, %v was fetched for batch senders %v", config.OutDirectory, m.BatchSenders)
+	}
+	var channel derive.ChannelID
+	if m.Channel != nil {
+		channel = *m.Channel
+	}
+	if channel != config.Channel {
+		return cachedRange{}, fmt.Errorf("cannot resume, %v was fetched with channel filter %v", config.OutDirectory, channel)
+	}
+	if m.Start < m.End && (m.End < config.Start || m.Start > config.End) {
+		return cachedRange{}, fmt.Errorf("cannot resume, %v holds blocks [%d,%d), which neither overlap with nor adjoin [%d,%d)",
+			config.OutDirectory, m.Start, m.End, config.Start, config.End)
+	}
+	c := cachedRange{
+		start:    max(m.Start, config.Start),
+		end:      min(m.End, config.End),
+		counts:   make(map[uint64]uint64),
+		stale:    make(map[uint64]struct{}),
+		previous: m,
+	}
+	found := make(map[uint64]uint64)
+	if err := scanCacheDir(config.OutDirectory, config, found); err != nil {
+		return cachedRange{}, err
+	}
+	for block, count := range m.TxCounts {
+		if block < c.start || block >= c.end {
+			continue
+		}
+		if found[block] != count {
+			c.stale[block] = struct{}{}
+		} else {
+			c.counts[block] = count
+		}
+	}
+	for block := range found {
+		if _, ok := m.TxCounts[block]; !ok && block >= c.start && block < c.end {
+			c.stale[block] = struct{}{}
+		}
+	}
+	return c, nil
+}
+
+// scanCacheDir counts the readable cached transactions of the configured chain and inbox per block
+// and removes the files which can't be decoded.
+func scanCacheDir(dir string, config Config, found map[uint64]uint64) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		f := path.Join(dir, file.Name())
+		if file.IsDir() {
+			if err := scanCacheDir(f, config, found); err != nil {
+				return err
+			}
+			continue
+		}
+		if IsMetadataFile(file.Name()) || path.Ext(f) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		var txm TransactionWithMetadata
+		if err := json.Unmarshal(data, &txm); err != nil {
+			fmt.Fprintf(config.logOutput(), "Removing corrupt cache file %v: %v\n", f, err)
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+			continue
+		}
+		if txm.ChainId == config.ChainID.Uint64() && txm.InboxAddr == config.BatchInbox {
+			found[txm.BlockNumber]++
+		}
+	}
+	return nil
+}
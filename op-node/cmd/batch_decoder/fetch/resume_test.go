@@ -0,0 +1,161 @@
+package fetch
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResume(t *testing.T) {
+	key := newTestKey(t)
+	newClient := func() *fakeL1Client {
+		client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+		for number := uint64(10); number < 16; number++ {
+			client.blocks[number] = testBatcherBlock(t, key, number)
+		}
+		return client
+	}
+	newConfig := func(dir string, end uint64) Config {
+		return Config{
+			Start:              10,
+			End:                end,
+			ChainID:            testChainID,
+			BatchInbox:         testInbox,
+			BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+			OutDirectory:       dir,
+			ConcurrentRequests: 2,
+			Resume:             true,
+		}
+	}
+	requireComplete := func(t *testing.T, dir string, end uint64) {
+		m, err := LoadManifest(dir)
+		require.NoError(t, err)
+		require.Equal(t, end, m.End)
+		require.Len(t, m.TxCounts, int(end-10))
+		require.Equal(t, []common.Address{key.addr}, m.BatchSenders)
+		require.NotZero(t, m.Timestamp)
+		issues, err := ValidateCache(dir)
+		require.NoError(t, err)
+		require.Empty(t, issues)
+	}
+
+	t.Run("Extend", func(t *testing.T) {
+		dir := t.TempDir()
+		Batches(newClient(), nil, newConfig(dir, 14))
+		client := newClient()
+		result := Batches(client, nil, newConfig(dir, 16))
+		require.Equal(t, uint64(4), result.SkippedBlocks)
+		require.Equal(t, uint64(2), result.TotalValid)
+		require.Equal(t, int64(2), client.calls.Load())
+		requireComplete(t, dir, 16)
+	})
+
+	t.Run("Interrupted", func(t *testing.T) {
+		dir := t.TempDir()
+		Batches(newClient(), nil, newConfig(dir, 16))
+		// A checkpoint only covering the first two blocks, as written by an interrupted fetch.
+		m, err := LoadManifest(dir)
+		require.NoError(t, err)
+		m.End = 12
+		m.TxCounts = map[uint64]uint64{10: 1, 11: 1}
+		require.NoError(t, WriteManifest(dir, m))
+
+		client := newClient()
+		result := Batches(client, nil, newConfig(dir, 16))
+		require.Equal(t, uint64(2), result.SkippedBlocks)
+		require.Equal(t, int64(4), client.calls.Load())
+		requireComplete(t, dir, 16)
+	})
+
+	t.Run("CorruptFile", func(t *testing.T) {
+		dir := t.TempDir()
+		client := newClient()
+		Batches(client, nil, newConfig(dir, 16))
+		tx := client.blocks[11].Transactions()[0]
+		file := CacheFilePath(dir, 0, 11, tx.Hash())
+		require.NoError(t, os.WriteFile(file, []byte(`{"tx_index":`), 0644))
+
+		client = newClient()
+		result := Batches(client, nil, newConfig(dir, 16))
+		require.Equal(t, uint64(5), result.SkippedBlocks)
+		require.Equal(t, int64(1), client.calls.Load(), "only the block of the corrupt file is fetched again")
+		require.FileExists(t, file)
+		requireComplete(t, dir, 16)
+	})
+
+	t.Run("NewerBlocks", func(t *testing.T) {
+		dir := t.TempDir()
+		Batches(newClient(), nil, newConfig(dir, 13))
+		// Only fetch the blocks after the previous fetch, the manifest covers both.
+		config := newConfig(dir, 16)
+		config.Start = 13
+		client := newClient()
+		result := Batches(client, nil, config)
+		require.Zero(t, result.SkippedBlocks)
+		require.Equal(t, int64(3), client.calls.Load())
+		requireComplete(t, dir, 16)
+		m, err := LoadManifest(dir)
+		require.NoError(t, err)
+		require.Equal(t, uint64(10), m.Start)
+	})
+
+	t.Run("WithinPreviousRange", func(t *testing.T) {
+		dir := t.TempDir()
+		Batches(newClient(), nil, newConfig(dir, 16))
+		config := newConfig(dir, 14)
+		config.Start = 12
+		client := newClient()
+		result := Batches(client, nil, config)
+		require.Equal(t, uint64(2), result.SkippedBlocks)
+		require.Zero(t, client.calls.Load())
+		requireComplete(t, dir, 16)
+	})
+
+	t.Run("DisjointRange", func(t *testing.T) {
+		dir := t.TempDir()
+		Batches(newClient(), nil, newConfig(dir, 12))
+		config := newConfig(dir, 16)
+		config.Start = 14
+		_, err := resumeRange(config)
+		require.ErrorContains(t, err, "neither overlap with nor adjoin")
+	})
+
+	t.Run("IncompatibleCache", func(t *testing.T) {
+		dir := t.TempDir()
+		Batches(newClient(), nil, newConfig(dir, 12))
+		config := newConfig(dir, 16)
+		config.ChainID = big.NewInt(1)
+		_, err := resumeRange(config)
+		require.ErrorContains(t, err, "cannot resume")
+	})
+
+	t.Run("OtherSenders", func(t *testing.T) {
+		dir := t.TempDir()
+		Batches(newClient(), nil, newConfig(dir, 12))
+		config := newConfig(dir, 16)
+		config.BatchSenders = map[common.Address]struct{}{{0x01}: {}}
+		_, err := resumeRange(config)
+		require.ErrorContains(t, err, "batch senders")
+	})
+}
+
+func TestProgressCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	p := newProgress(Config{Start: 0, ChainID: testChainID, BatchInbox: testInbox})
+	p.record(5)
+	// Complete the blocks in reverse order, no checkpoint is written until the prefix is complete.
+	for number := uint64(checkpointInterval); number > 0; number-- {
+		require.NoError(t, p.complete(number, dir))
+		require.NoFileExists(t, path.Join(dir, ManifestFile))
+	}
+	require.NoError(t, p.complete(0, dir))
+	m, err := LoadManifest(dir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(checkpointInterval+1), m.End)
+	require.Equal(t, map[uint64]uint64{5: 1}, m.TxCounts)
+}
@@ -0,0 +1,115 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/metrics"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// retryStrategy determines the backoff between attempts to fetch a block.
+var retryStrategy = retry.Exponential()
+
+// limitExceededErrorCode is the JSON-RPC error code used by L1 providers to report rate limiting.
+const limitExceededErrorCode = -32005
+
+// fetchBatchesPerBlockWithRetries fetches the batches of a block like fetchBatchesPerBlock, retrying up to
+// config.MaxRetries times with exponential backoff and jitter if the attempt failed with a retryable error.
+func fetchBatchesPerBlockWithRetries(ctx context.Context, client L1Client, beacon derive.L1BlobsFetcher, number uint64, signer types.Signer, config Config) (uint64, uint64, error) {
+	for attempt := 0; ; attempt++ {
+		config.progress.reset(number)
+		config.channelFrames.reset(number)
+		m := &attemptMetrics{Metricer: config.Metrics}
+		attemptConfig := config
+		attemptConfig.Metrics = m
+		valid, invalid, err := fetchBatchesPerBlock(ctx, client, beacon, number, signer, attemptConfig)
+		if err == nil {
+			m.flush()
+		}
+		if err == nil || ctx.Err() != nil || !isRetryable(err) {
+			return valid, invalid, err
+		}
+		if attempt >= config.MaxRetries {
+			return 0, 0, fmt.Errorf("giving up after %d retries: %w", attempt, err)
+		}
+		delay := retryStrategy.Duration(attempt)
+		fmt.Fprintf(config.logOutput(), "Failed to fetch block %v (attempt %d of %d), retrying in %v: %v\n", number, attempt+1, config.MaxRetries+1, delay, err)
+		if !sleepCtx(ctx, delay) {
+			return 0, 0, ctx.Err()
+		}
+	}
+}
+
+// attemptMetrics holds back the metrics recorded while fetching a block until the attempt succeeds, so the
+// block and its decode errors are counted once, however often the fetch is retried.
+type attemptMetrics struct {
+	metrics.Metricer
+	blocksFetched int
+	decodeErrors  []string
+}
+
+func (m *attemptMetrics) RecordBlockFetched() {
+	m.blocksFetched++
+}
+
+func (m *attemptMetrics) RecordDecodeError(category string) {
+	m.decodeErrors = append(m.decodeErrors, category)
+}
+
+// flush records the held back metrics.
+func (m *attemptMetrics) flush() {
+	for i := 0; i < m.blocksFetched; i++ {
+		m.Metricer.RecordBlockFetched()
+	}
+	for _, category := range m.decodeErrors {
+		m.Metricer.RecordDecodeError(category)
+	}
+}
+
+// blobFetchError is a failed blob request to the beacon node.
+type blobFetchError struct {
+	err error
+}
+
+func (e *blobFetchError) Error() string {
+	return fmt.Sprintf("failed to fetch blobs: %v", e.err)
+}
+
+func (e *blobFetchError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable reports whether the error of a block fetch is transient: a timeout, a connection error,
+// a server error or rate limiting by the provider. Other errors, e.g. a block that is not found, are permanent.
+func isRetryable(err error) bool {
+	// The beacon client only reports the HTTP status of a failed request in its error message, so every
+	// failure to fetch blobs is treated as transient, except for blobs which the beacon node doesn't have.
+	var blobErr *blobFetchError
+	if errors.As(err, &blobErr) {
+		return !errors.Is(err, ethereum.NotFound) && !errors.Is(err, context.Canceled)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500 || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == limitExceededErrorCode
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,232 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/metrics"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyL1Client fails the first requests of every block with err.
+type flakyL1Client struct {
+	*fakeL1Client
+	failures int
+	err      error
+
+	mu       sync.Mutex
+	attempts map[uint64]int
+}
+
+func (f *flakyL1Client) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	f.mu.Lock()
+	f.attempts[number.Uint64()]++
+	fail := f.attempts[number.Uint64()] <= f.failures
+	f.mu.Unlock()
+	if fail {
+		return nil, f.err
+	}
+	return f.fakeL1Client.BlockByNumber(ctx, number)
+}
+
+func TestFetchRetries(t *testing.T) {
+	defer func(s retry.Strategy) { retryStrategy = s }(retryStrategy)
+	retryStrategy = retry.Fixed(0)
+
+	key := newTestKey(t)
+	newClient := func(failures int, err error) *flakyL1Client {
+		client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+		for number := uint64(10); number < 13; number++ {
+			client.blocks[number] = testBatcherBlock(t, key, number)
+		}
+		return &flakyL1Client{fakeL1Client: client, failures: failures, err: err, attempts: make(map[uint64]int)}
+	}
+	newConfig := func() Config {
+		return Config{
+			Start:              10,
+			End:                13,
+			ChainID:            testChainID,
+			BatchInbox:         testInbox,
+			BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+			OutDirectory:       t.TempDir(),
+			ConcurrentRequests: 3,
+			MaxRetries:         2,
+		}
+	}
+
+	t.Run("RecoversFromTransientErrors", func(t *testing.T) {
+		client := newClient(2, rpc.HTTPError{StatusCode: 503, Status: "503 Service Unavailable"})
+		config := newConfig()
+		result := Batches(client, nil, config)
+		require.Equal(t, uint64(3), result.TotalValid)
+		for number := uint64(10); number < 13; number++ {
+			require.Equal(t, 3, client.attempts[number])
+		}
+		m, err := LoadManifest(config.OutDirectory)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{10: 1, 11: 1, 12: 1}, m.TxCounts)
+	})
+
+	signer := types.LatestSignerForChainID(testChainID)
+	t.Run("GivesUpAfterMaxRetries", func(t *testing.T) {
+		client := newClient(3, context.DeadlineExceeded)
+		_, _, err := fetchBatchesPerBlockWithRetries(context.Background(), client, nil, 10, signer, newConfig())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, 3, client.attempts[10])
+	})
+
+	t.Run("PermanentError", func(t *testing.T) {
+		client := newClient(1, ethereum.NotFound)
+		_, _, err := fetchBatchesPerBlockWithRetries(context.Background(), client, nil, 10, signer, newConfig())
+		require.ErrorIs(t, err, ethereum.NotFound)
+		require.Equal(t, 1, client.attempts[10])
+	})
+}
+
+// flakyBlobsFetcher fails the first requests for blobs with err.
+type flakyBlobsFetcher struct {
+	*fakeBlobsFetcher
+	failures int
+	err      error
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (f *flakyBlobsFetcher) GetBlobs(ctx context.Context, ref eth.L1BlockRef, hashes []eth.IndexedBlobHash) ([]*eth.Blob, error) {
+	f.mu.Lock()
+	f.attempts++
+	fail := f.attempts <= f.failures
+	f.mu.Unlock()
+	if fail {
+		return nil, f.err
+	}
+	return f.fakeBlobsFetcher.GetBlobs(ctx, ref, hashes)
+}
+
+// countingMetrics counts the fetched blocks and decode errors.
+type countingMetrics struct {
+	metrics.Metricer
+	blocksFetched int
+	decodeErrors  map[string]int
+}
+
+func (m *countingMetrics) RecordBlockFetched() {
+	m.blocksFetched++
+}
+
+func (m *countingMetrics) RecordDecodeError(category string) {
+	m.decodeErrors[category]++
+}
+
+func TestFetchBlobRetries(t *testing.T) {
+	defer func(s retry.Strategy) { retryStrategy = s }(retryStrategy)
+	retryStrategy = retry.Fixed(0)
+
+	key := newTestKey(t)
+	signer := types.LatestSignerForChainID(testChainID)
+	data := append([]byte{derive.DerivationVersion0}, frameBytes(t, derive.Frame{ID: derive.ChannelID{0x01}, IsLast: true})...)
+	blobTx := types.MustSignNewTx(key.priv, signer, &types.BlobTx{
+		ChainID:    uint256.MustFromBig(testChainID),
+		To:         testInbox,
+		BlobHashes: []common.Hash{{0x01}},
+	})
+	client := &fakeL1Client{blocks: map[uint64]*types.Block{
+		10: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(10)}).WithBody(types.Body{Transactions: []*types.Transaction{blobTx}}),
+	}}
+	newConfig := func() Config {
+		return Config{
+			ChainID:      testChainID,
+			BatchInbox:   testInbox,
+			BatchSenders: map[common.Address]struct{}{key.addr: {}},
+			OutDirectory: t.TempDir(),
+			Metrics:      metrics.NoopMetrics,
+			MaxRetries:   2,
+		}
+	}
+
+	t.Run("RecoversFromTransientErrors", func(t *testing.T) {
+		beacon := &flakyBlobsFetcher{
+			fakeBlobsFetcher: &fakeBlobsFetcher{data: data},
+			failures:         2,
+			err:              errors.New("failed request with status 503: unavailable"),
+		}
+		config := newConfig()
+		valid, _, err := fetchBatchesPerBlockWithRetries(context.Background(), client, beacon, 10, signer, config)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), valid)
+		require.Equal(t, 3, beacon.attempts)
+		require.FileExists(t, CacheFilePath(config.OutDirectory, 0, 10, blobTx.Hash()))
+	})
+
+	t.Run("RecordsMetricsOnce", func(t *testing.T) {
+		// The calldata transaction with invalid frame data is processed before the blob request fails.
+		invalidTx := types.MustSignNewTx(key.priv, signer, &types.DynamicFeeTx{
+			ChainID: testChainID,
+			Nonce:   1,
+			To:      &testInbox,
+			Data:    []byte{0xff},
+		})
+		client := &fakeL1Client{blocks: map[uint64]*types.Block{
+			10: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(10)}).WithBody(types.Body{Transactions: []*types.Transaction{invalidTx, blobTx}}),
+		}}
+		beacon := &flakyBlobsFetcher{
+			fakeBlobsFetcher: &fakeBlobsFetcher{data: data},
+			failures:         2,
+			err:              errors.New("failed request with status 503: unavailable"),
+		}
+		m := &countingMetrics{decodeErrors: make(map[string]int)}
+		config := newConfig()
+		config.Metrics = m
+		_, invalid, err := fetchBatchesPerBlockWithRetries(context.Background(), client, beacon, 10, signer, config)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), invalid)
+		require.Equal(t, 3, beacon.attempts)
+		require.Equal(t, 1, m.blocksFetched)
+		require.Equal(t, map[string]int{metrics.ErrFrameParse: 1}, m.decodeErrors)
+	})
+
+	t.Run("GivesUpAfterMaxRetries", func(t *testing.T) {
+		beacon := &flakyBlobsFetcher{
+			fakeBlobsFetcher: &fakeBlobsFetcher{data: data},
+			failures:         3,
+			err:              errors.New("failed request with status 503: unavailable"),
+		}
+		_, _, err := fetchBatchesPerBlockWithRetries(context.Background(), client, beacon, 10, signer, newConfig())
+		require.ErrorContains(t, err, "status 503")
+		require.Equal(t, 3, beacon.attempts)
+	})
+
+	t.Run("MissingBlobs", func(t *testing.T) {
+		beacon := &flakyBlobsFetcher{
+			fakeBlobsFetcher: &fakeBlobsFetcher{data: data},
+			failures:         1,
+			err:              ethereum.NotFound,
+		}
+		_, _, err := fetchBatchesPerBlockWithRetries(context.Background(), client, beacon, 10, signer, newConfig())
+		require.ErrorIs(t, err, ethereum.NotFound)
+		require.Equal(t, 1, beacon.attempts)
+	})
+}
+
+func TestIsRetryable(t *testing.T) {
+	require.True(t, isRetryable(context.DeadlineExceeded))
+	require.True(t, isRetryable(rpc.HTTPError{StatusCode: 502}))
+	require.True(t, isRetryable(rpc.HTTPError{StatusCode: 429}))
+	require.False(t, isRetryable(rpc.HTTPError{StatusCode: 401}))
+	require.False(t, isRetryable(ethereum.NotFound))
+	require.False(t, isRetryable(context.Canceled))
+	require.True(t, isRetryable(&blobFetchError{err: errors.New("failed request with status 500")}))
+	require.False(t, isRetryable(&blobFetchError{err: ethereum.NotFound}))
+}
@@ -0,0 +1,132 @@
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// CacheIssueKind categorizes inconsistencies found by ValidateCache and VerifyCache.
+type CacheIssueKind string
+
+const (
+	// IssueMissingMetadata means the manifest lacks the chain ID or batch inbox.
+	IssueMissingMetadata CacheIssueKind = "missing_metadata"
+	// IssueUnreadableFile means a cache file can't be decoded.
+	IssueUnreadableFile CacheIssueKind = "unreadable_file"
+	// IssueOutOfRange means a cached transaction is outside of the declared block range.
+	IssueOutOfRange CacheIssueKind = "out_of_range"
+	// IssueMetadataMismatch means a cached transaction was fetched for another chain or inbox.
+	IssueMetadataMismatch CacheIssueKind = "metadata_mismatch"
+	// IssueMissingTransactions means fewer transactions of a block are cached than were fetched.
+	IssueMissingTransactions CacheIssueKind = "missing_transactions"
+	// IssueUnexpectedTransactions means more transactions of a block are cached than were fetched.
+	IssueUnexpectedTransactions CacheIssueKind = "unexpected_transactions"
+	// IssueChecksumMismatch means a cache file doesn't match its recorded checksum, e.g. because it is truncated.
+	IssueChecksumMismatch CacheIssueKind = "checksum_mismatch"
+	// IssueMissingFile means a cache file with a recorded checksum doesn't exist.
+	IssueMissingFile CacheIssueKind = "missing_file"
+	// IssueMissingChecksum means no checksum is recorded for a cache file.
+	IssueMissingChecksum CacheIssueKind = "missing_checksum"
+)
+
+// CacheIssue is a single inconsistency of a transaction cache.
+type CacheIssue struct {
+	Kind   CacheIssueKind
+	Detail string
+}
+
+func (i CacheIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Kind, i.Detail)
+}
+
+// ValidateCache checks that the transaction cache in dir is consistent with its manifest:
+// the manifest declares the chain and inbox, all cached transactions belong to them and to the
+// declared block range, and every block has exactly as many cached transactions as were fetched.
+// An error is returned if the manifest can't be read.
+func ValidateCache(dir string) ([]CacheIssue, error) {
+	m, err := LoadManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest of %v: %w", dir, err)
+	}
+	var issues []CacheIssue
+	if m.ChainID == 0 {
+		issues = append(issues, CacheIssue{IssueMissingMetadata, "manifest has no chain ID"})
+	}
+	if (m.BatchInbox == common.Address{}) {
+		issues = append(issues, CacheIssue{IssueMissingMetadata, "manifest has no batch inbox"})
+	}
+
+	found := make(map[uint64]uint64)
+	if err := validateCacheDir(dir, m, found, &issues); err != nil {
+		return nil, err
+	}
+
+	blocks := make(map[uint64]struct{})
+	for b := range m.TxCounts {
+		blocks[b] = struct{}{}
+	}
+	for b := range found {
+		blocks[b] = struct{}{}
+	}
+	sorted := make([]uint64, 0, len(blocks))
+	for b := range blocks {
+		sorted = append(sorted, b)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, b := range sorted {
+		expected, actual := m.TxCounts[b], found[b]
+		if actual < expected {
+			issues = append(issues, CacheIssue{IssueMissingTransactions,
+				fmt.Sprintf("block %d: expected %d transactions, found %d", b, expected, actual)})
+		} else if actual > expected {
+			issues = append(issues, CacheIssue{IssueUnexpectedTransactions,
+				fmt.Sprintf("block %d: expected %d transactions, found %d", b, expected, actual)})
+		}
+	}
+	return issues, nil
+}
+
+func validateCacheDir(dir string, m Manifest, found map[uint64]uint64, issues *[]CacheIssue) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		f := path.Join(dir, file.Name())
+		if file.IsDir() {
+			if err := validateCacheDir(f, m, found, issues); err != nil {
+				return err
+			}
+			continue
+		}
+		if IsMetadataFile(file.Name()) || path.Ext(f) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		var txm TransactionWithMetadata
+		if err := json.Unmarshal(data, &txm); err != nil {
+			*issues = append(*issues, CacheIssue{IssueUnreadableFile, fmt.Sprintf("%v: %v", f, err)})
+			continue
+		}
+		if txm.BlockNumber < m.Start || txm.BlockNumber >= m.End {
+			*issues = append(*issues, CacheIssue{IssueOutOfRange,
+				fmt.Sprintf("%v: block %d outside of range [%d, %d)", f, txm.BlockNumber, m.Start, m.End)})
+			continue
+		}
+		if txm.ChainId != m.ChainID || txm.InboxAddr != m.BatchInbox {
+			*issues = append(*issues, CacheIssue{IssueMetadataMismatch,
+				fmt.Sprintf("%v: chain %d and inbox %v, expected chain %d and inbox %v",
+					f, txm.ChainId, txm.InboxAddr, m.ChainID, m.BatchInbox)})
+		}
+		found[txm.BlockNumber]++
+	}
+	return nil
+}
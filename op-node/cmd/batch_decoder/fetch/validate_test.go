@@ -0,0 +1,137 @@
+package fetch
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCache(t *testing.T) {
+	key := newTestKey(t)
+	client := &fakeL1Client{blocks: make(map[uint64]*types.Block)}
+	for number := uint64(10); number < 14; number++ {
+		client.blocks[number] = testBatcherBlock(t, key, number)
+	}
+	// Blocks without inbox transactions are not gaps.
+	client.blocks[12] = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(12)})
+
+	fetchCache := func(t *testing.T) Config {
+		config := Config{
+			Start:              10,
+			End:                14,
+			ChainID:            testChainID,
+			BatchInbox:         testInbox,
+			BatchSenders:       map[common.Address]struct{}{key.addr: {}},
+			OutDirectory:       t.TempDir(),
+			ConcurrentRequests: 2,
+			BlocksPerDirectory: 2,
+		}
+		Batches(client, nil, config)
+		return config
+	}
+	cachePath := func(config Config, number uint64) string {
+		tx := client.blocks[number].Transactions()[0]
+		return CacheFilePath(config.OutDirectory, config.BlocksPerDirectory, number, tx.Hash())
+	}
+	requireIssue := func(t *testing.T, dir string, kind CacheIssueKind) {
+		issues, err := ValidateCache(dir)
+		require.NoError(t, err)
+		require.Len(t, issues, 1, "issues: %v", issues)
+		require.Equal(t, kind, issues[0].Kind)
+	}
+
+	t.Run("Consistent", func(t *testing.T) {
+		config := fetchCache(t)
+		m, err := LoadManifest(config.OutDirectory)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{10: 1, 11: 1, 13: 1}, m.TxCounts)
+		issues, err := ValidateCache(config.OutDirectory)
+		require.NoError(t, err)
+		require.Empty(t, issues)
+	})
+
+	t.Run("IgnoresOtherFiles", func(t *testing.T) {
+		config := fetchCache(t)
+		require.NoError(t, os.WriteFile(path.Join(config.OutDirectory, ManifestFile+".tmp"), []byte("{"), 0644))
+		require.NoError(t, os.WriteFile(path.Join(config.OutDirectory, "notes.txt"), []byte("not a transaction"), 0644))
+		issues, err := ValidateCache(config.OutDirectory)
+		require.NoError(t, err)
+		require.Empty(t, issues)
+	})
+
+	t.Run("MissingManifest", func(t *testing.T) {
+		config := fetchCache(t)
+		require.NoError(t, os.Remove(path.Join(config.OutDirectory, ManifestFile)))
+		_, err := ValidateCache(config.OutDirectory)
+		require.Error(t, err)
+	})
+
+	t.Run("MissingMetadata", func(t *testing.T) {
+		config := fetchCache(t)
+		m, err := LoadManifest(config.OutDirectory)
+		require.NoError(t, err)
+		m.ChainID = 0
+		require.NoError(t, WriteManifest(config.OutDirectory, m))
+		issues, err := ValidateCache(config.OutDirectory)
+		require.NoError(t, err)
+		kinds := make(map[CacheIssueKind]bool)
+		for _, issue := range issues {
+			kinds[issue.Kind] = true
+		}
+		require.True(t, kinds[IssueMissingMetadata])
+	})
+
+	t.Run("MissingTransactions", func(t *testing.T) {
+		config := fetchCache(t)
+		require.NoError(t, os.Remove(cachePath(config, 11)))
+		requireIssue(t, config.OutDirectory, IssueMissingTransactions)
+	})
+
+	t.Run("UnreadableFile", func(t *testing.T) {
+		config := fetchCache(t)
+		require.NoError(t, os.WriteFile(cachePath(config, 11), []byte("{"), 0644))
+		issues, err := ValidateCache(config.OutDirectory)
+		require.NoError(t, err)
+		require.Len(t, issues, 2)
+		require.Equal(t, IssueMissingTransactions, issues[1].Kind)
+		require.Equal(t, IssueUnreadableFile, issues[0].Kind)
+	})
+
+	t.Run("OutOfRange", func(t *testing.T) {
+		config := fetchCache(t)
+		m, err := LoadManifest(config.OutDirectory)
+		require.NoError(t, err)
+		m.End = 13
+		delete(m.TxCounts, 13)
+		require.NoError(t, WriteManifest(config.OutDirectory, m))
+		requireIssue(t, config.OutDirectory, IssueOutOfRange)
+	})
+
+	t.Run("MetadataMismatch", func(t *testing.T) {
+		config := fetchCache(t)
+		m, err := LoadManifest(config.OutDirectory)
+		require.NoError(t, err)
+		m.BatchInbox = common.Address{0x01}
+		require.NoError(t, WriteManifest(config.OutDirectory, m))
+		issues, err := ValidateCache(config.OutDirectory)
+		require.NoError(t, err)
+		require.Len(t, issues, 3)
+		for _, issue := range issues {
+			require.Equal(t, IssueMetadataMismatch, issue.Kind)
+		}
+	})
+
+	t.Run("UnexpectedTransactions", func(t *testing.T) {
+		config := fetchCache(t)
+		m, err := LoadManifest(config.OutDirectory)
+		require.NoError(t, err)
+		delete(m.TxCounts, 13)
+		require.NoError(t, WriteManifest(config.OutDirectory, m))
+		requireIssue(t, config.OutDirectory, IssueUnexpectedTransactions)
+	})
+}
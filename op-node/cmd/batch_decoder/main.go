@@ -2,23 +2,37 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
 	"os"
+	"strings"
 	"time"
 
+	opnode "github.com/ethereum-optimism/optimism/op-node"
 	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/metrics"
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/outputs"
 	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/reassemble"
 	"github.com/ethereum-optimism/optimism/op-node/rollup"
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
 	"github.com/ethereum-optimism/optimism/op-service/client"
+	"github.com/ethereum-optimism/optimism/op-service/dial"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/ethereum-optimism/optimism/op-service/opio"
 	"github.com/ethereum-optimism/optimism/op-service/sources"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/urfave/cli/v2"
 )
 
+const EnvVarPrefix = "BATCH_DECODER"
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "batch-decoder"
@@ -27,31 +41,39 @@ func main() {
 		{
 			Name:  "fetch",
 			Usage: "Fetches batches in the specified range",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.IntFlag{
 					Name:     "start",
 					Required: true,
 					Usage:    "First block (inclusive) to fetch",
 				},
 				&cli.IntFlag{
-					Name:     "end",
-					Required: true,
-					Usage:    "Last block (exclusive) to fetch",
+					Name:  "end",
+					Usage: "Last block (exclusive) to fetch. Optional with --l1.ws, where 0 follows L1 indefinitely",
+				},
+				&cli.Uint64Flag{
+					Name:  "max-blocks",
+					Value: 100_000,
+					Usage: "Refuse to fetch ranges of more L1 blocks than this without --force, to catch typos in --start and --end. 0 disables the check",
+				},
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "Fetch ranges exceeding --max-blocks",
 				},
 				&cli.StringFlag{
 					Name:     "inbox",
 					Required: true,
 					Usage:    "Batch Inbox Address",
 				},
-				&cli.StringFlag{
+				&cli.StringSliceFlag{
 					Name:     "sender",
 					Required: true,
-					Usage:    "Batch Sender Address",
+					Usage:    "Batch Sender Address. May be repeated for chains with multiple or rotated batcher keys",
 				},
 				&cli.StringFlag{
 					Name:  "out",
 					Value: "/tmp/batch_decoder/transactions_cache",
-					Usage: "Cache directory for the found transactions",
+					Usage: "Cache directory for the found transactions. May contain the template variables {chainID}, {start} and {end}",
 				},
 				&cli.StringFlag{
 					Name:     "l1",
@@ -59,19 +81,108 @@ func main() {
 					Usage:    "L1 RPC URL",
 					EnvVars:  []string{"L1_RPC"},
 				},
+				&cli.StringFlag{
+					Name:    "l1.ws",
+					Usage:   "L1 websocket RPC URL. When set, new L1 heads are followed from --start and batches are fetched as blocks arrive",
+					EnvVars: []string{"L1_WS"},
+				},
 				&cli.StringFlag{
 					Name:     "l1.beacon",
 					Required: false,
 					Usage:    "Address of L1 Beacon-node HTTP endpoint to use",
 					EnvVars:  []string{"L1_BEACON"},
 				},
+				&cli.BoolFlag{
+					Name:  "l1.beacon.verify-chain",
+					Usage: "Check that the L1 Beacon node serves the same chain as the L1 RPC, using the chain ID of its deposit contract",
+				},
+				&cli.BoolFlag{
+					Name:  "l1.trace-filter",
+					Usage: "Use trace_filter to fetch only the transactions sent to the batch inbox instead of full L1 blocks. Falls back to full blocks if unsupported by the L1 RPC",
+				},
 				&cli.IntFlag{
 					Name:  "concurrent-requests",
 					Value: 10,
 					Usage: "Concurrency level when fetching L1",
 				},
-			},
+				&cli.Float64Flag{
+					Name:  "rps",
+					Value: 0,
+					Usage: "Maximum rate of requests per second to the L1 RPC, shared by all concurrent requests. 0 is unlimited",
+				},
+				&cli.IntFlag{
+					Name:  "max-retries",
+					Value: 5,
+					Usage: "Number of times to retry fetching a block after a timeout, server error or rate limiting",
+				},
+				&cli.Uint64Flag{
+					Name:  "beacon-concurrent-requests",
+					Value: 0,
+					Usage: "Concurrency level when fetching blob sidecars from the L1 Beacon node. 0 only applies the L1 concurrency level",
+				},
+				&cli.Uint64Flag{
+					Name:  "blocks-per-dir",
+					Value: 0,
+					Usage: "Shard the cache into subdirectories covering this many L1 blocks each. 0 writes a flat cache directory",
+				},
+				&cli.BoolFlag{
+					Name:  "blobs-only",
+					Usage: "Only cache the blob transactions sent to the batch inbox, skipping calldata batches. Requires --l1.beacon",
+				},
+				&cli.StringFlag{
+					Name:  "channel-id",
+					Usage: "(Optional) Only cache the transactions carrying a frame of the channel with this hex encoded ID",
+				},
+				&cli.BoolFlag{
+					Name:  "resume",
+					Usage: "Skip the blocks which a previous fetch into the out directory already cached completely",
+				},
+				&cli.DurationFlag{
+					Name:  "progress",
+					Value: 0,
+					Usage: "Log the number of fetched blocks and batches at this interval, e.g. 30s. 0 disables progress logging",
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Value: "text",
+					Usage: "Format of the summary, text or json. With json, the summary is the only output on stdout and progress is logged to stderr",
+				},
+			}, opmetrics.CLIFlags(EnvVarPrefix)...),
 			Action: func(cliCtx *cli.Context) error {
+				format := cliCtx.String("format")
+				if format != "text" && format != "json" {
+					return fmt.Errorf("unknown format %q, expected text or json", format)
+				}
+				senders := make(map[common.Address]struct{})
+				for _, sender := range cliCtx.StringSlice("sender") {
+					if !common.IsHexAddress(sender) {
+						return fmt.Errorf("invalid batch sender address %q", sender)
+					}
+					senders[common.HexToAddress(sender)] = struct{}{}
+				}
+				var channel derive.ChannelID
+				if id := cliCtx.String("channel-id"); id != "" {
+					if err := channel.UnmarshalText([]byte(strings.TrimPrefix(id, "0x"))); err != nil {
+						return fmt.Errorf("invalid channel ID %q: %w", id, err)
+					}
+				}
+				logOut := logOutput(format == "json")
+				if err := validateFetchRange(cliCtx, logOut); err != nil {
+					return err
+				}
+				if cliCtx.String("l1.ws") != "" {
+					// Following L1 writes no manifest, so there is nothing to resume from or report progress against.
+					for _, flag := range []string{"resume", "progress"} {
+						if cliCtx.IsSet(flag) {
+							return fmt.Errorf("--%s is not supported when following L1 with --l1.ws", flag)
+						}
+					}
+				}
+				m, stopMetrics, err := startMetricsServer(cliCtx, logOut)
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer stopMetrics()
 				l1Client, err := ethclient.Dial(cliCtx.String("l1"))
 				if err != nil {
 					log.Fatal(err)
@@ -83,44 +194,90 @@ func main() {
 					log.Fatal(err)
 				}
 				beaconAddr := cliCtx.String("l1.beacon")
+				if beaconAddr == "" && cliCtx.Bool("blobs-only") {
+					return errors.New("--blobs-only requires --l1.beacon to fetch the blob data")
+				}
 				var beacon *sources.L1BeaconClient
 				if beaconAddr != "" {
-					beaconClient := sources.NewBeaconHTTPClient(client.NewBasicHTTPClient(beaconAddr, nil))
+					beaconHTTP := client.NewBasicHTTPClient(beaconAddr, nil)
+					beaconClient := sources.NewBeaconHTTPClient(beaconHTTP)
 					beaconCfg := sources.L1BeaconClientConfig{FetchAllSidecars: false}
 					beacon = sources.NewL1BeaconClient(beaconClient, beaconCfg)
 					_, err := beacon.GetVersion(ctx)
 					if err != nil {
 						log.Fatal(fmt.Errorf("failed to check L1 Beacon API version: %w", err))
 					}
+					if cliCtx.Bool("l1.beacon.verify-chain") {
+						if err := fetch.VerifyBeaconChainID(ctx, beaconHTTP, chainID); err != nil {
+							log.Fatal(err)
+						}
+					}
 				} else {
-					fmt.Println("L1 Beacon endpoint not set. Unable to fetch post-ecotone channel frames")
+					fmt.Fprintln(logOut, "L1 Beacon endpoint not set. Unable to fetch post-ecotone channel frames")
 				}
 				config := fetch.Config{
-					Start:   uint64(cliCtx.Int("start")),
-					End:     uint64(cliCtx.Int("end")),
-					ChainID: chainID,
-					BatchSenders: map[common.Address]struct{}{
-						common.HexToAddress(cliCtx.String("sender")): {},
-					},
-					BatchInbox:         common.HexToAddress(cliCtx.String("inbox")),
-					OutDirectory:       cliCtx.String("out"),
-					ConcurrentRequests: uint64(cliCtx.Int("concurrent-requests")),
-				}
-				totalValid, totalInvalid := fetch.Batches(l1Client, beacon, config)
-				fmt.Printf("Fetched batches in range [%v,%v). Found %v valid & %v invalid batches\n", config.Start, config.End, totalValid, totalInvalid)
-				fmt.Printf("Fetch Config: Chain ID: %v. Inbox Address: %v. Valid Senders: %v.\n", config.ChainID, config.BatchInbox, config.BatchSenders)
-				fmt.Printf("Wrote transactions with batches to %v\n", config.OutDirectory)
+					Start:                    uint64(cliCtx.Int("start")),
+					End:                      uint64(cliCtx.Int("end")),
+					ChainID:                  chainID,
+					BatchSenders:             senders,
+					BatchInbox:               common.HexToAddress(cliCtx.String("inbox")),
+					OutDirectory:             cliCtx.String("out"),
+					ConcurrentRequests:       uint64(cliCtx.Int("concurrent-requests")),
+					BlocksPerDirectory:       cliCtx.Uint64("blocks-per-dir"),
+					BeaconConcurrentRequests: cliCtx.Uint64("beacon-concurrent-requests"),
+					Metrics:                  m,
+					Resume:                   cliCtx.Bool("resume"),
+					BlobsOnly:                cliCtx.Bool("blobs-only"),
+					RequestsPerSecond:        cliCtx.Float64("rps"),
+					MaxRetries:               cliCtx.Int("max-retries"),
+					ProgressInterval:         cliCtx.Duration("progress"),
+					Channel:                  channel,
+					Log:                      logOut,
+				}
+				if cliCtx.Bool("l1.trace-filter") {
+					config.TxFilter = fetch.NewTraceFilterFetcher(l1Client, logOut)
+				}
+				config.OutDirectory, err = fetch.ExpandOutDirectory(config.OutDirectory, config.ChainID, config.Start, config.End)
+				if err != nil {
+					return err
+				}
+				var result fetch.Result
+				if wsAddr := cliCtx.String("l1.ws"); wsAddr != "" {
+					wsClient, err := ethclient.Dial(wsAddr)
+					if err != nil {
+						log.Fatal(err)
+					}
+					defer wsClient.Close()
+					fmt.Fprintf(logOut, "Following L1 heads from block %v\n", config.Start)
+					result, err = fetch.Follow(opio.CancelOnInterrupt(cliCtx.Context), l1Client, wsClient, beacon, config)
+					if err != nil {
+						log.Fatal(err)
+					}
+				} else {
+					result = fetch.Batches(l1Client, beacon, config)
+				}
+				if format == "json" {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(result)
+				}
+				fmt.Printf("Fetched batches in range [%v,%v). Found %v valid & %v invalid batches\n", result.Start, result.End, result.TotalValid, result.TotalInvalid)
+				fmt.Printf("Fetch Config: Chain ID: %v. Inbox Address: %v. Valid Senders: %v.\n", result.ChainID, result.BatchInbox, result.BatchSenders)
+				if result.Channel != nil {
+					fmt.Printf("Found %v frames of channel %v\n", result.ChannelFrames, result.Channel)
+				}
+				fmt.Printf("Wrote transactions with batches to %v\n", result.OutDirectory)
 				return nil
 			},
 		},
 		{
 			Name:  "reassemble",
 			Usage: "Reassembles channels from fetched batch transactions and decode batches",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
 					Name:  "in",
 					Value: "/tmp/batch_decoder/transactions_cache",
-					Usage: "Cache directory for the found transactions",
+					Usage: "Cache directory for the found transactions, or an s3://<bucket>/<prefix> URL",
 				},
 				&cli.StringFlag{
 					Name:  "out",
@@ -132,6 +289,10 @@ func main() {
 					Value: 10,
 					Usage: "L2 chain id for span batch derivation. Default value from op-mainnet.",
 				},
+				&cli.StringFlag{
+					Name:  "rollup-config",
+					Usage: "(Optional) Rollup config JSON file of the L2 chain. Takes precedence over the superchain-registry, for chains which are not registered",
+				},
 				&cli.Uint64Flag{
 					Name:  "l2-genesis-timestamp",
 					Value: 1686068903,
@@ -150,39 +311,240 @@ func main() {
 					Usage: "Batch Inbox Address. Default value from op-mainnet. " +
 						"Superchain-registry prioritized when given value is inconsistent.",
 				},
-			},
+				&cli.StringFlag{
+					Name:  "dump-channel-bank",
+					Usage: "(Optional) File to write the channel bank state to: the channels which are open or pending at the given L1 block",
+				},
+				&cli.Uint64Flag{
+					Name:  "dump-channel-bank.l1-block",
+					Usage: "L1 block (inclusive) up to which frames are processed for the channel bank state. 0 processes all frames of the cache",
+				},
+				&cli.StringFlag{
+					Name:  "l1-conflicts",
+					Value: reassemble.ConflictPolicyFail.String(),
+					Usage: fmt.Sprintf("How to handle conflicting versions of an L1 block in the cache, one of %v. "+
+						"canonical requires --l1", reassemble.ConflictPolicies),
+				},
+				&cli.StringFlag{
+					Name:  "l1",
+					Usage: "(Optional) L1 RPC URL, used to look up canonical L1 blocks with --l1-conflicts=canonical",
+				},
+				&cli.StringFlag{
+					Name:  "ndjson",
+					Usage: "(Optional) File to write a JSON summary of every decoded L2 block to, one per line. - writes to stdout and moves the progress output to stderr",
+				},
+				&cli.StringFlag{
+					Name:  "cost-report",
+					Usage: "(Optional) File to write a JSON report of the bytes posted and the estimated L1 fees of every channel to",
+				},
+				&cli.StringFlag{
+					Name:  "report-incomplete",
+					Usage: "(Optional) File to write a JSON report of the channels which never became ready to, with the frames received for each",
+				},
+				&cli.BoolFlag{
+					Name:  "validate-cache",
+					Usage: "Check that the transaction cache is consistent with its manifest before reassembling, and fail if it isn't",
+				},
+			}, opmetrics.CLIFlags(EnvVarPrefix)...),
 			Action: func(cliCtx *cli.Context) error {
+				logOut := logOutput(cliCtx.String("ndjson") == "-")
+				if cliCtx.Bool("validate-cache") {
+					if err := validateCache(cliCtx.String("in"), logOut); err != nil {
+						log.Fatal(err)
+					}
+				}
+				m, stopMetrics, err := startMetricsServer(cliCtx, logOut)
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer stopMetrics()
 				var (
 					L2GenesisTime     uint64         = cliCtx.Uint64("l2-genesis-timestamp")
 					L2BlockTime       uint64         = cliCtx.Uint64("l2-block-time")
 					BatchInboxAddress common.Address = common.HexToAddress(cliCtx.String("inbox"))
 				)
 				L2ChainID := new(big.Int).SetUint64(cliCtx.Uint64("l2-chain-id"))
-				rollupCfg, err := rollup.LoadOPStackRollupConfig(L2ChainID.Uint64())
+				rollupCfg, err := loadRollupConfig(cliCtx)
 				if err == nil {
-					// prioritize superchain config
+					// prioritize the rollup config file or superchain config
+					if L2ChainID.Cmp(rollupCfg.L2ChainID) != 0 {
+						L2ChainID = rollupCfg.L2ChainID
+						fmt.Fprintf(logOut, "L2ChainID overridden: %v\n", L2ChainID)
+					}
 					if L2GenesisTime != rollupCfg.Genesis.L2Time {
 						L2GenesisTime = rollupCfg.Genesis.L2Time
-						fmt.Printf("L2GenesisTime overridden: %v\n", L2GenesisTime)
+						fmt.Fprintf(logOut, "L2GenesisTime overridden: %v\n", L2GenesisTime)
 					}
 					if L2BlockTime != rollupCfg.BlockTime {
 						L2BlockTime = rollupCfg.BlockTime
-						fmt.Printf("L2BlockTime overridden: %v\n", L2BlockTime)
+						fmt.Fprintf(logOut, "L2BlockTime overridden: %v\n", L2BlockTime)
 					}
 					if BatchInboxAddress != rollupCfg.BatchInboxAddress {
 						BatchInboxAddress = rollupCfg.BatchInboxAddress
-						fmt.Printf("BatchInboxAddress overridden: %v\n", BatchInboxAddress)
+						fmt.Fprintf(logOut, "BatchInboxAddress overridden: %v\n", BatchInboxAddress)
 					}
+				} else if cliCtx.IsSet("rollup-config") {
+					return err
+				} else if err := validateRollupFlags(L2ChainID.Uint64(), L2GenesisTime, L2BlockTime); err != nil {
+					return err
+				}
+				conflictPolicy, err := reassemble.ParseConflictPolicy(cliCtx.String("l1-conflicts"))
+				if err != nil {
+					log.Fatal(err)
 				}
 				config := reassemble.Config{
-					BatchInbox:    BatchInboxAddress,
-					InDirectory:   cliCtx.String("in"),
-					OutDirectory:  cliCtx.String("out"),
-					L2ChainID:     L2ChainID,
-					L2GenesisTime: L2GenesisTime,
-					L2BlockTime:   L2BlockTime,
+					BatchInbox:       BatchInboxAddress,
+					InDirectory:      cliCtx.String("in"),
+					OutDirectory:     cliCtx.String("out"),
+					L2ChainID:        L2ChainID,
+					L2GenesisTime:    L2GenesisTime,
+					L2BlockTime:      L2BlockTime,
+					Metrics:          m,
+					ConflictPolicy:   conflictPolicy,
+					IncompleteReport: cliCtx.String("report-incomplete"),
+					CostReport:       cliCtx.String("cost-report"),
+					Log:              logOut,
+				}
+				if l1 := cliCtx.String("l1"); l1 != "" {
+					l1Client, err := ethclient.Dial(l1)
+					if err != nil {
+						log.Fatal(err)
+					}
+					config.L1 = l1Client
+				}
+				switch out := cliCtx.String("ndjson"); out {
+				case "":
+				case "-":
+					config.BatchSummaries = os.Stdout
+				default:
+					f, err := os.Create(out)
+					if err != nil {
+						log.Fatal(err)
+					}
+					defer f.Close()
+					config.BatchSummaries = f
+				}
+				if rollupCfg == nil {
+					rollupCfg = config.RollupConfig()
 				}
 				reassemble.Channels(config, rollupCfg)
+				if out := cliCtx.String("dump-channel-bank"); out != "" {
+					state := reassemble.ChannelBank(config, rollupCfg, cliCtx.Uint64("dump-channel-bank.l1-block"))
+					if err := reassemble.WriteChannelBankState(state, out); err != nil {
+						log.Fatal(err)
+					}
+					fmt.Fprintf(logOut, "Wrote channel bank state at L1 block %v with %v buffered channels to %v\n", state.L1Block, len(state.Channels), out)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "validate-cache",
+			Usage: "Checks that the transaction cache is consistent with the manifest written by fetch",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "in",
+					Value: "/tmp/batch_decoder/transactions_cache",
+					Usage: "Cache directory for the found transactions",
+				},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				if err := validateCache(cliCtx.String("in"), os.Stdout); err != nil {
+					log.Fatal(err)
+				}
+				fmt.Println("Transaction cache is consistent")
+				return nil
+			},
+		},
+		{
+			Name:  "verify-cache",
+			Usage: "Checks the files of the transaction cache against the checksums written by fetch",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "in",
+					Value: "/tmp/batch_decoder/transactions_cache",
+					Usage: "Cache directory for the found transactions",
+				},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				dir := cliCtx.String("in")
+				issues, err := fetch.VerifyCache(dir)
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, issue := range issues {
+					fmt.Println(issue)
+				}
+				if len(issues) > 0 {
+					log.Fatalf("transaction cache %v has %d corrupt or missing files", dir, len(issues))
+				}
+				fmt.Println("Transaction cache matches its checksums")
+				return nil
+			},
+		},
+		{
+			Name:  "diff-cache",
+			Usage: "Compares two transaction caches, e.g. fetched from different L1 providers",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:     "in",
+					Required: true,
+					Usage:    "The two cache directories to compare, as --in <a> --in <b>",
+				},
+				&cli.BoolFlag{
+					Name:  "details",
+					Usage: "List every transaction which is missing from one of the caches or differs between them",
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Value: "text",
+					Usage: "Output format, text or json. json always includes the details",
+				},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				format := cliCtx.String("format")
+				if format != "text" && format != "json" {
+					return fmt.Errorf("unknown format %q, expected text or json", format)
+				}
+				dirs := cliCtx.StringSlice("in")
+				if len(dirs) != 2 {
+					return fmt.Errorf("expected two cache directories, got %d", len(dirs))
+				}
+				a, b := dirs[0], dirs[1]
+				diff, err := fetch.DiffCaches(a, b)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if format == "json" {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					if err := enc.Encode(diff); err != nil {
+						log.Fatal(err)
+					}
+				} else {
+					fmt.Printf("Identical transactions: %d\n", diff.Identical)
+					fmt.Printf("Only in %v: %d\n", a, len(diff.OnlyA))
+					fmt.Printf("Only in %v: %d\n", b, len(diff.OnlyB))
+					fmt.Printf("Different: %d\n", len(diff.Different))
+					fmt.Printf("Unreadable: %d\n", len(diff.Unreadable))
+					if cliCtx.Bool("details") {
+						for _, e := range diff.OnlyA {
+							fmt.Printf("block %d: %v only in %v\n", e.Block, e.TxHash, a)
+						}
+						for _, e := range diff.OnlyB {
+							fmt.Printf("block %d: %v only in %v\n", e.Block, e.TxHash, b)
+						}
+						for _, e := range diff.Different {
+							fmt.Printf("block %d: %v differs in %v\n", e.Block, e.TxHash, strings.Join(e.Fields, ", "))
+						}
+						for _, f := range diff.Unreadable {
+							fmt.Printf("unreadable: %v\n", f)
+						}
+					}
+				}
+				if !diff.Equal() {
+					return fmt.Errorf("transaction caches %v and %v differ", a, b)
+				}
 				return nil
 			},
 		},
@@ -203,7 +565,16 @@ func main() {
 				&cli.StringFlag{
 					Name:  "in",
 					Value: "/tmp/batch_decoder/transactions_cache",
-					Usage: "Cache directory for the found transactions",
+					Usage: "Cache directory for the found transactions, or an s3://<bucket>/<prefix> URL",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Report the state of the channel's frames instead of creating the tx data",
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Value: "text",
+					Usage: "Format of the --dry-run report, text or json",
 				},
 			},
 			Action: func(cliCtx *cli.Context) error {
@@ -211,6 +582,10 @@ func main() {
 				if err := (&id).UnmarshalText([]byte(cliCtx.String("id"))); err != nil {
 					log.Fatal(err)
 				}
+				format := cliCtx.String("format")
+				if format != "text" && format != "json" {
+					return fmt.Errorf("unknown format %q, expected text or json", format)
+				}
 				frames := reassemble.LoadFrames(cliCtx.String("in"), common.HexToAddress(cliCtx.String("inbox")))
 				var filteredFrames []derive.Frame
 				for _, frame := range frames {
@@ -218,6 +593,25 @@ func main() {
 						filteredFrames = append(filteredFrames, frame.Frame)
 					}
 				}
+				if cliCtx.Bool("dry-run") {
+					check := reassemble.CheckForceClose(id, filteredFrames)
+					if format == "json" {
+						enc := json.NewEncoder(os.Stdout)
+						enc.SetIndent("", "  ")
+						if err := enc.Encode(check); err != nil {
+							return err
+						}
+					} else {
+						fmt.Printf("Channel %v: %v matching frames\n", id.String(), check.Frames)
+						fmt.Printf("Already closed: %v\n", check.Closed)
+						fmt.Printf("Highest frame number: %v, marked IsLast: %v\n", check.HighestFrameNumber, check.LastFrameIsLast)
+						fmt.Printf("Missing frame numbers: %v\n", check.MissingFrames)
+					}
+					if check.Frames == 0 {
+						return fmt.Errorf("no frames found for channel %v", id.String())
+					}
+					return nil
+				}
 				data, err := derive.ForceCloseTxData(filteredFrames)
 				if err != nil {
 					log.Fatal(err)
@@ -226,9 +620,416 @@ func main() {
 				return nil
 			},
 		},
+		{
+			Name:  "decode-frame",
+			Usage: "Decodes the frames of raw batcher transaction data",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "data",
+					Usage: "Hex encoded transaction data, starting with the derivation version byte. Read from stdin if not set",
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Value: "text",
+					Usage: "Output format, text or json",
+				},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				format := cliCtx.String("format")
+				if format != "text" && format != "json" {
+					return fmt.Errorf("unknown format %q, expected text or json", format)
+				}
+				input := cliCtx.String("data")
+				if input == "" {
+					in, err := io.ReadAll(os.Stdin)
+					if err != nil {
+						return err
+					}
+					input = string(in)
+				}
+				input = strings.TrimSpace(input)
+				if !strings.HasPrefix(input, "0x") {
+					input = "0x" + input
+				}
+				data, err := hexutil.Decode(input)
+				if err != nil {
+					return fmt.Errorf("invalid hex data: %w", err)
+				}
+				frames, err := reassemble.DecodeFrames(data)
+				if err != nil {
+					return err
+				}
+				if format == "json" {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(frames)
+				}
+				for _, frame := range frames {
+					fmt.Printf("Channel %v frame %v: %v bytes, is last: %v\n", frame.ID.String(), frame.FrameNumber, frame.DataLength, frame.IsLast)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "decode-blob",
+			Usage: "Fetches the blobs of an L1 block from the beacon node and decodes their frames, without a transaction cache",
+			Flags: []cli.Flag{
+				&cli.Uint64Flag{
+					Name:  "block",
+					Usage: "L1 block containing the blobs. Required unless --hash is set",
+				},
+				&cli.StringFlag{
+					Name:  "hash",
+					Usage: "(Optional) Versioned hash of the blob to decode. All blobs of the block are decoded if not set",
+				},
+				&cli.StringFlag{
+					Name:  "in",
+					Value: "/tmp/batch_decoder/transactions_cache",
+					Usage: "Cache directory for the found transactions, or an s3://<bucket>/<prefix> URL. Used to look up the block of --hash if --block is not set",
+				},
+				&cli.StringFlag{
+					Name:  "inbox",
+					Value: "0x0000000000000000000000000000000000000000",
+					Usage: "(Optional) Batch Inbox Address. Only blobs sent to it are decoded",
+				},
+				&cli.StringFlag{
+					Name:     "l1",
+					Required: true,
+					Usage:    "L1 RPC URL",
+					EnvVars:  []string{"L1_RPC"},
+				},
+				&cli.StringFlag{
+					Name:     "l1.beacon",
+					Required: true,
+					Usage:    "Address of L1 Beacon-node HTTP endpoint to use",
+					EnvVars:  []string{"L1_BEACON"},
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Value: "text",
+					Usage: "Output format, text or json",
+				},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				format := cliCtx.String("format")
+				if format != "text" && format != "json" {
+					return fmt.Errorf("unknown format %q, expected text or json", format)
+				}
+				var versionedHash common.Hash
+				if hash := cliCtx.String("hash"); hash != "" {
+					b, err := hexutil.Decode(hash)
+					if err != nil || len(b) != common.HashLength {
+						return fmt.Errorf("invalid versioned hash %q", hash)
+					}
+					versionedHash = common.BytesToHash(b)
+				}
+				inbox := cliCtx.String("inbox")
+				if !common.IsHexAddress(inbox) {
+					return fmt.Errorf("invalid inbox address %q", inbox)
+				}
+				block := cliCtx.Uint64("block")
+				if !cliCtx.IsSet("block") {
+					if versionedHash == (common.Hash{}) {
+						return errors.New("either --block or --hash is required")
+					}
+					var err error
+					block, err = reassemble.FindBlobBlock(cliCtx.String("in"), versionedHash)
+					if err != nil {
+						return err
+					}
+				}
+				ctx := context.Background()
+				l1Client, err := ethclient.Dial(cliCtx.String("l1"))
+				if err != nil {
+					log.Fatal(err)
+				}
+				beaconClient := sources.NewBeaconHTTPClient(client.NewBasicHTTPClient(cliCtx.String("l1.beacon"), nil))
+				beacon := sources.NewL1BeaconClient(beaconClient, sources.L1BeaconClientConfig{FetchAllSidecars: false})
+				blobs, err := fetch.BlockBlobs(ctx, l1Client, beacon, block, common.HexToAddress(inbox), versionedHash)
+				if err != nil {
+					return err
+				}
+				decoded := reassemble.DecodeBlobs(blobs)
+				if format == "json" {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(decoded)
+				}
+				for _, blob := range decoded {
+					fmt.Printf("Blob %v (index %v) of transaction %v:\n", blob.VersionedHash, blob.Index, blob.TxHash)
+					if blob.Error != "" {
+						fmt.Printf("  %v\n", blob.Error)
+					}
+					for _, frame := range blob.Frames {
+						fmt.Printf("  Channel %v frame %v: %v bytes, is last: %v\n", frame.ID.String(), frame.FrameNumber, frame.DataLength, frame.IsLast)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "compute-output-roots",
+			Usage: "Computes the output root of each L2 block in the range and compares it against the rollup node",
+			Flags: []cli.Flag{
+				&cli.Uint64Flag{
+					Name:     "start",
+					Required: true,
+					Usage:    "First L2 block (inclusive) to verify",
+				},
+				&cli.Uint64Flag{
+					Name:     "end",
+					Required: true,
+					Usage:    "Last L2 block (exclusive) to verify",
+				},
+				&cli.StringFlag{
+					Name:     "l2",
+					Required: true,
+					Usage:    "L2 RPC URL",
+					EnvVars:  []string{"L2_RPC"},
+				},
+				&cli.StringFlag{
+					Name:     "rollup",
+					Required: true,
+					Usage:    "Rollup node RPC URL",
+					EnvVars:  []string{"ROLLUP_RPC"},
+				},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				if err := outputs.ValidateRange(cliCtx.Uint64("start"), cliCtx.Uint64("end")); err != nil {
+					return err
+				}
+				logger := oplog.NewLogger(os.Stderr, oplog.DefaultCLIConfig())
+				ctx := cliCtx.Context
+				rollupClient, err := dial.DialRollupClientWithTimeout(ctx, dial.DefaultDialTimeout, logger, cliCtx.String("rollup"))
+				if err != nil {
+					log.Fatal(err)
+				}
+				rollupCfg, err := rollupClient.RollupConfig(ctx)
+				if err != nil {
+					log.Fatal(fmt.Errorf("failed to fetch rollup config: %w", err))
+				}
+				l2RPC, err := dial.DialRPCClientWithTimeout(ctx, dial.DefaultDialTimeout, logger, cliCtx.String("l2"))
+				if err != nil {
+					log.Fatal(err)
+				}
+				l2Client, err := sources.NewL2Client(client.NewBaseRPCClient(l2RPC), logger, nil, sources.L2ClientDefaultConfig(rollupCfg, false))
+				if err != nil {
+					log.Fatal(err)
+				}
+				results, err := outputs.Compute(ctx, l2Client, rollupClient, cliCtx.Uint64("start"), cliCtx.Uint64("end"))
+				if err != nil {
+					log.Fatal(err)
+				}
+				mismatches := 0
+				for _, result := range results {
+					if result.Match {
+						fmt.Printf("PASS block %v: output root %v\n", result.BlockNumber, result.Computed)
+					} else {
+						mismatches++
+						fmt.Printf("FAIL block %v: computed output root %v (block hash %v), rollup node reported %v (block hash %v)\n",
+							result.BlockNumber, result.Computed, result.BlockHash, result.Reported, result.ReportedHash)
+					}
+				}
+				if mismatches > 0 {
+					return fmt.Errorf("%v of %v output roots did not match", mismatches, len(results))
+				}
+				fmt.Printf("All %v output roots match\n", len(results))
+				return nil
+			},
+		},
+		{
+			Name:  "by-l1-tx",
+			Usage: "Reports the channels and L2 block ranges that an L1 batch transaction contributed to",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "tx",
+					Required: true,
+					Usage:    "Hash of the L1 batch transaction",
+				},
+				&cli.StringFlag{
+					Name:  "in",
+					Value: "/tmp/batch_decoder/transactions_cache",
+					Usage: "Cache directory for the found transactions, or an s3://<bucket>/<prefix> URL",
+				},
+				&cli.Uint64Flag{
+					Name:  "l2-chain-id",
+					Value: 10,
+					Usage: "L2 chain id, used to load the rollup config from the superchain-registry. Default value from op-mainnet.",
+				},
+				&cli.StringFlag{
+					Name:  "rollup-config",
+					Usage: "(Optional) Rollup config JSON file of the L2 chain. Takes precedence over the superchain-registry, for chains which are not registered",
+				},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				var txHash common.Hash
+				if err := txHash.UnmarshalText([]byte(cliCtx.String("tx"))); err != nil {
+					return fmt.Errorf("invalid transaction hash: %w", err)
+				}
+				rollupCfg, err := loadRollupConfig(cliCtx)
+				if err != nil {
+					return fmt.Errorf("failed to load rollup config: %w", err)
+				}
+				config := reassemble.Config{
+					BatchInbox:    rollupCfg.BatchInboxAddress,
+					InDirectory:   cliCtx.String("in"),
+					L2ChainID:     rollupCfg.L2ChainID,
+					L2GenesisTime: rollupCfg.Genesis.L2Time,
+					L2BlockTime:   rollupCfg.BlockTime,
+					// Keep the log output of the reassembly out of the JSON result.
+					Log: os.Stderr,
+				}
+				result, err := reassemble.BatchRangesByTx(config, rollupCfg, txHash)
+				if err != nil {
+					return err
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(result)
+			},
+		},
+		{
+			Name:  "bench",
+			Usage: "Benchmarks reassembling & decoding all channels of a transaction cache",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "in",
+					Value: "/tmp/batch_decoder/transactions_cache",
+					Usage: "Cache directory for the found transactions, or an s3://<bucket>/<prefix> URL",
+				},
+				&cli.Uint64Flag{
+					Name:  "l2-chain-id",
+					Value: 10,
+					Usage: "L2 chain id, used to load the rollup config from the superchain-registry. Default value from op-mainnet.",
+				},
+				&cli.StringFlag{
+					Name:  "rollup-config",
+					Usage: "(Optional) Rollup config JSON file of the L2 chain. Takes precedence over the superchain-registry, for chains which are not registered",
+				},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				rollupCfg, err := loadRollupConfig(cliCtx)
+				if err != nil {
+					return fmt.Errorf("failed to load rollup config: %w", err)
+				}
+				config := reassemble.Config{
+					BatchInbox:    rollupCfg.BatchInboxAddress,
+					InDirectory:   cliCtx.String("in"),
+					L2ChainID:     rollupCfg.L2ChainID,
+					L2GenesisTime: rollupCfg.Genesis.L2Time,
+					L2BlockTime:   rollupCfg.BlockTime,
+					// Keep the log output of the reassembly out of the JSON report.
+					Log: os.Stderr,
+				}
+				report := reassemble.Bench(config, rollupCfg)
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(report)
+			},
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// validateFetchRange checks the --start and --end flags of the fetch command before any work is done.
+// --end may only be omitted, or 0, when following L1 with --l1.ws.
+func validateFetchRange(cliCtx *cli.Context, logOut io.Writer) error {
+	start, end := cliCtx.Int("start"), cliCtx.Int("end")
+	if start < 0 {
+		return fmt.Errorf("--start must not be negative, got %d", start)
+	}
+	if end < 0 {
+		return fmt.Errorf("--end must not be negative, got %d", end)
+	}
+	follow := cliCtx.String("l1.ws") != ""
+	if !follow && !cliCtx.IsSet("end") {
+		return errors.New("--end is required unless following L1 with --l1.ws")
+	}
+	if follow && end == 0 {
+		return nil
+	}
+	if end <= start {
+		return fmt.Errorf("--end (%d) must be greater than --start (%d), the range excludes --end", end, start)
+	}
+	blocks := uint64(end - start)
+	fmt.Fprintf(logOut, "Fetching %d L1 blocks in range [%d,%d)\n", blocks, start, end)
+	if maxBlocks := cliCtx.Uint64("max-blocks"); maxBlocks != 0 && blocks > maxBlocks && !cliCtx.Bool("force") {
+		return fmt.Errorf("range [%d,%d) of %d blocks exceeds --max-blocks %d, pass --force to fetch it anyway", start, end, blocks, maxBlocks)
+	}
+	return nil
+}
+
+// loadRollupConfig loads the rollup config from the --rollup-config file if set, or else from the
+// superchain-registry by --l2-chain-id.
+func loadRollupConfig(cliCtx *cli.Context) (*rollup.Config, error) {
+	if path := cliCtx.String("rollup-config"); path != "" {
+		return opnode.NewRollupConfig(oplog.NewLogger(os.Stderr, oplog.DefaultCLIConfig()), "", path)
+	}
+	return rollup.LoadOPStackRollupConfig(cliCtx.Uint64("l2-chain-id"))
+}
+
+// validateRollupFlags checks the L2 chain parameters given by flags for chains which aren't in the
+// superchain-registry, since inconsistent values produce garbage span batch derivation.
+func validateRollupFlags(chainID, genesisTime, blockTime uint64) error {
+	if chainID == 0 {
+		return errors.New("--l2-chain-id must not be 0")
+	}
+	if blockTime == 0 {
+		return fmt.Errorf("--l2-block-time must not be 0 for chain %d, which is not in the superchain-registry", chainID)
+	}
+	if now := uint64(time.Now().Unix()); genesisTime > now {
+		return fmt.Errorf("--l2-genesis-timestamp %d of chain %d, which is not in the superchain-registry, is in the future", genesisTime, chainID)
+	}
+	return nil
+}
+
+// validateCache prints all inconsistencies of the transaction cache in dir to out and fails if there are any.
+func validateCache(dir string, out io.Writer) error {
+	if strings.HasPrefix(dir, "s3://") {
+		return fmt.Errorf("cannot validate %v, only local transaction caches can be validated", dir)
+	}
+	issues, err := fetch.ValidateCache(dir)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(out, issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("transaction cache %v has %d inconsistencies", dir, len(issues))
+	}
+	return nil
+}
+
+// logOutput returns the writer a command prints its log output to. Commands which write machine-readable
+// output, like JSON, to stdout log to stderr instead, so the output stays parseable.
+func logOutput(machineReadable bool) io.Writer {
+	if machineReadable {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// startMetricsServer starts the metrics server if enabled by the CLI flags, and prints its address to logOut.
+// The returned function stops the server again.
+func startMetricsServer(cliCtx *cli.Context, logOut io.Writer) (metrics.Metricer, func(), error) {
+	cfg := opmetrics.ReadCLIConfig(cliCtx)
+	if err := cfg.Check(); err != nil {
+		return nil, nil, err
+	}
+	if !cfg.Enabled {
+		return metrics.NoopMetrics, func() {}, nil
+	}
+	m := metrics.NewMetrics()
+	server, err := opmetrics.StartServer(m.Registry(), cfg.ListenAddr, cfg.ListenPort)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start metrics server: %w", err)
+	}
+	fmt.Fprintf(logOut, "Serving metrics at http://%v/metrics\n", server.Addr())
+	return m, func() {
+		_ = server.Stop(context.Background())
+	}, nil
+}
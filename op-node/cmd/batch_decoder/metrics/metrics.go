@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
+)
+
+const Namespace = "op_batch_decoder"
+
+// Decode error categories
+const (
+	ErrFrameParse       = "frame_parse"
+	ErrChannelFrame     = "channel_frame"
+	ErrBatchReader      = "batch_reader"
+	ErrBatchData        = "batch_data"
+	ErrSingularBatch    = "singular_batch"
+	ErrSpanBatch        = "span_batch"
+	ErrUnknownBatchType = "unknown_batch_type"
+)
+
+// implements the Registry getter, for metrics HTTP server to hook into
+var _ opmetrics.RegistryMetricer = (*Metrics)(nil)
+
+type Metricer interface {
+	RecordBlockFetched()
+	RecordBatches(valid, invalid uint64)
+	RecordChannelReassembled(ready bool)
+	RecordDecodeError(category string)
+}
+
+type Metrics struct {
+	ns       string
+	registry *prometheus.Registry
+	factory  opmetrics.Factory
+
+	blocksFetched       prometheus.Counter
+	batches             *prometheus.CounterVec
+	channelsReassembled *prometheus.CounterVec
+	decodeErrors        *prometheus.CounterVec
+}
+
+var _ Metricer = (*Metrics)(nil)
+
+func NewMetrics() *Metrics {
+	ns := Namespace
+
+	registry := opmetrics.NewRegistry()
+	factory := opmetrics.With(registry)
+
+	return &Metrics{
+		ns:       ns,
+		registry: registry,
+		factory:  factory,
+
+		blocksFetched: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "blocks_fetched_total",
+			Help:      "Number of L1 blocks fetched",
+		}),
+		batches: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "batches_total",
+			Help:      "Number of batch transactions found, by validity",
+		}, []string{
+			"validity",
+		}),
+		channelsReassembled: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "channels_reassembled_total",
+			Help:      "Number of channels reassembled, by whether the channel was ready",
+		}, []string{
+			"ready",
+		}),
+		decodeErrors: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "decode_errors_total",
+			Help:      "Number of errors while decoding frames, channels and batches, by category",
+		}, []string{
+			"category",
+		}),
+	}
+}
+
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+func (m *Metrics) Document() []opmetrics.DocumentedMetric {
+	return m.factory.Document()
+}
+
+func (m *Metrics) RecordBlockFetched() {
+	m.blocksFetched.Inc()
+}
+
+func (m *Metrics) RecordBatches(valid, invalid uint64) {
+	m.batches.WithLabelValues("valid").Add(float64(valid))
+	m.batches.WithLabelValues("invalid").Add(float64(invalid))
+}
+
+func (m *Metrics) RecordChannelReassembled(ready bool) {
+	if ready {
+		m.channelsReassembled.WithLabelValues("true").Inc()
+	} else {
+		m.channelsReassembled.WithLabelValues("false").Inc()
+	}
+}
+
+func (m *Metrics) RecordDecodeError(category string) {
+	m.decodeErrors.WithLabelValues(category).Inc()
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
+)
+
+func TestMetricsServer(t *testing.T) {
+	m := NewMetrics()
+	m.RecordBlockFetched()
+	m.RecordBlockFetched()
+	m.RecordBatches(3, 1)
+	m.RecordChannelReassembled(true)
+	m.RecordDecodeError(ErrSpanBatch)
+
+	server, err := opmetrics.StartServer(m.Registry(), "127.0.0.1", 0)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, server.Stop(context.Background()))
+	}()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", server.Addr()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, string(body), "op_batch_decoder_blocks_fetched_total 2")
+	require.Contains(t, string(body), `op_batch_decoder_batches_total{validity="valid"} 3`)
+	require.Contains(t, string(body), `op_batch_decoder_batches_total{validity="invalid"} 1`)
+	require.Contains(t, string(body), `op_batch_decoder_channels_reassembled_total{ready="true"} 1`)
+	require.Contains(t, string(body), `op_batch_decoder_decode_errors_total{category="span_batch"} 1`)
+}
@@ -0,0 +1,10 @@
+package metrics
+
+type noopMetrics struct{}
+
+var NoopMetrics Metricer = new(noopMetrics)
+
+func (*noopMetrics) RecordBlockFetched()                 {}
+func (*noopMetrics) RecordBatches(valid, invalid uint64) {}
+func (*noopMetrics) RecordChannelReassembled(ready bool) {}
+func (*noopMetrics) RecordDecodeError(category string)   {}
@@ -0,0 +1,71 @@
+package outputs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// L2Client is the subset of the L2 execution client needed to compute output roots.
+type L2Client interface {
+	InfoByNumber(ctx context.Context, number uint64) (eth.BlockInfo, error)
+	OutputV0AtBlock(ctx context.Context, blockHash common.Hash) (*eth.OutputV0, error)
+}
+
+// RollupClient is the subset of the rollup node client used to fetch the reported output roots.
+type RollupClient interface {
+	OutputAtBlock(ctx context.Context, blockNum uint64) (*eth.OutputResponse, error)
+}
+
+type OutputRootResult struct {
+	BlockNumber  uint64      `json:"block_number"`
+	BlockHash    common.Hash `json:"block_hash"`
+	Computed     eth.Bytes32 `json:"computed_output_root"`
+	Reported     eth.Bytes32 `json:"reported_output_root"`
+	ReportedHash common.Hash `json:"reported_block_hash"`
+	Match        bool        `json:"match"`
+}
+
+// ValidateRange checks the L2 block range (inclusive to exclusive) before any output root is computed.
+func ValidateRange(start, end uint64) error {
+	if end <= start {
+		return fmt.Errorf("--end (%d) must be greater than --start (%d), the range excludes --end", end, start)
+	}
+	return nil
+}
+
+// Compute computes the output root of every L2 block in the given range (inclusive to exclusive)
+// from the block's state root, the L2ToL1MessagePasser storage root and the block hash, and
+// compares it against the output root reported by the rollup node.
+func Compute(ctx context.Context, l2 L2Client, rollupClient RollupClient, start, end uint64) ([]OutputRootResult, error) {
+	if err := ValidateRange(start, end); err != nil {
+		return nil, err
+	}
+	var results []OutputRootResult
+	for number := start; number < end; number++ {
+		info, err := l2.InfoByNumber(ctx, number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch L2 block %d: %w", number, err)
+		}
+		output, err := l2.OutputV0AtBlock(ctx, info.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute output of L2 block %d: %w", number, err)
+		}
+		reported, err := rollupClient.OutputAtBlock(ctx, number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch reported output of L2 block %d: %w", number, err)
+		}
+		computed := eth.OutputRoot(output)
+		results = append(results, OutputRootResult{
+			BlockNumber:  number,
+			BlockHash:    info.Hash(),
+			Computed:     computed,
+			Reported:     reported.OutputRoot,
+			ReportedHash: reported.BlockRef.Hash,
+			Match:        computed == reported.OutputRoot && info.Hash() == reported.BlockRef.Hash,
+		})
+	}
+	return results, nil
+}
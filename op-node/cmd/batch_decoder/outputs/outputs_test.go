@@ -0,0 +1,81 @@
+package outputs
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum-optimism/optimism/op-service/testutils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+type stubL2Client struct {
+	outputs map[uint64]*eth.OutputV0
+}
+
+func (s *stubL2Client) InfoByNumber(_ context.Context, number uint64) (eth.BlockInfo, error) {
+	output, ok := s.outputs[number]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &testutils.MockBlockInfo{InfoHash: output.BlockHash, InfoNum: number}, nil
+}
+
+func (s *stubL2Client) OutputV0AtBlock(_ context.Context, blockHash common.Hash) (*eth.OutputV0, error) {
+	for _, output := range s.outputs {
+		if output.BlockHash == blockHash {
+			return output, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+type stubRollupClient struct {
+	outputs map[uint64]*eth.OutputResponse
+}
+
+func (s *stubRollupClient) OutputAtBlock(_ context.Context, number uint64) (*eth.OutputResponse, error) {
+	return s.outputs[number], nil
+}
+
+func TestCompute(t *testing.T) {
+	l2 := &stubL2Client{outputs: make(map[uint64]*eth.OutputV0)}
+	rollupClient := &stubRollupClient{outputs: make(map[uint64]*eth.OutputResponse)}
+	for number := uint64(10); number < 13; number++ {
+		output := &eth.OutputV0{
+			StateRoot:                eth.Bytes32{byte(number)},
+			MessagePasserStorageRoot: eth.Bytes32{0xee},
+			BlockHash:                common.BigToHash(new(big.Int).SetUint64(number)),
+		}
+		l2.outputs[number] = output
+		rollupClient.outputs[number] = &eth.OutputResponse{
+			OutputRoot: eth.OutputRoot(output),
+			BlockRef:   eth.L2BlockRef{Hash: output.BlockHash, Number: number},
+		}
+	}
+	// The rollup node disagrees on the state of block 11.
+	rollupClient.outputs[11].OutputRoot = eth.Bytes32{0xba, 0xd0}
+
+	results, err := Compute(context.Background(), l2, rollupClient, 10, 13)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.True(t, results[0].Match)
+	require.False(t, results[1].Match)
+	require.Equal(t, eth.OutputRoot(l2.outputs[11]), results[1].Computed)
+	require.True(t, results[2].Match)
+
+	_, err = Compute(context.Background(), l2, rollupClient, 12, 14)
+	require.ErrorContains(t, err, "failed to fetch L2 block 13")
+}
+
+func TestValidateRange(t *testing.T) {
+	require.NoError(t, ValidateRange(10, 11))
+	require.ErrorContains(t, ValidateRange(10, 10), "must be greater than --start")
+	require.ErrorContains(t, ValidateRange(11, 10), "must be greater than --start")
+
+	_, err := Compute(context.Background(), &stubL2Client{}, &stubRollupClient{}, 5, 0)
+	require.ErrorContains(t, err, "must be greater than --start")
+}
@@ -0,0 +1,123 @@
+package reassemble
+
+import (
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// BenchReport summarizes the throughput of reassembling and decoding a transaction cache.
+type BenchReport struct {
+	L1Blocks          uint64 `json:"l1_blocks"`
+	Frames            uint64 `json:"frames"`
+	Channels          uint64 `json:"channels"`
+	L2Blocks          uint64 `json:"l2_blocks"`
+	DecompressedBytes uint64 `json:"decompressed_bytes"`
+
+	LoadDuration   time.Duration `json:"load_duration"`
+	DecodeDuration time.Duration `json:"decode_duration"`
+
+	L1BlocksPerSec       float64 `json:"l1_blocks_per_sec"`
+	ChannelsPerSec       float64 `json:"channels_per_sec"`
+	L2BlocksPerSec       float64 `json:"l2_blocks_per_sec"`
+	DecompressedMBPerSec float64 `json:"decompressed_mb_per_sec"`
+	PeakHeapBytes        uint64  `json:"peak_heap_bytes"`
+}
+
+// Bench loads all frames from the input directory, then reassembles & decodes every channel
+// without writing any output, and reports the throughput of both stages.
+// Rates are computed over the total duration of loading and decoding.
+func Bench(config Config, rollupCfg *rollup.Config) BenchReport {
+	var report BenchReport
+	stopSampling := sampleHeap(&report.PeakHeapBytes)
+	defer stopSampling()
+
+	start := time.Now()
+	frames, err := loadFrames(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report.LoadDuration = time.Since(start)
+
+	start = time.Now()
+	l1Blocks := make(map[uint64]struct{})
+	framesByChannel := make(map[derive.ChannelID][]FrameWithMetadata)
+	for _, frame := range frames {
+		l1Blocks[frame.InclusionBlock] = struct{}{}
+		framesByChannel[frame.Frame.ID] = append(framesByChannel[frame.Frame.ID], frame)
+	}
+	for id, frames := range framesByChannel {
+		ch := processFrames(config, rollupCfg, id, frames)
+		report.DecompressedBytes += ch.DecompressedBytes
+		for _, batch := range ch.Batches {
+			switch b := batch.(type) {
+			case *derive.SingularBatch:
+				if b != nil {
+					report.L2Blocks++
+				}
+			case *derive.SpanBatch:
+				if b != nil {
+					report.L2Blocks += uint64(b.GetBlockCount())
+				}
+			}
+		}
+	}
+	report.DecodeDuration = time.Since(start)
+
+	report.L1Blocks = uint64(len(l1Blocks))
+	report.Frames = uint64(len(frames))
+	report.Channels = uint64(len(framesByChannel))
+	if total := (report.LoadDuration + report.DecodeDuration).Seconds(); total > 0 {
+		report.L1BlocksPerSec = float64(report.L1Blocks) / total
+		report.ChannelsPerSec = float64(report.Channels) / total
+		report.L2BlocksPerSec = float64(report.L2Blocks) / total
+		report.DecompressedMBPerSec = float64(report.DecompressedBytes) / 1e6 / total
+	}
+	stopSampling()
+	return report
+}
+
+// sampleHeap periodically records the highest observed heap allocation into peak
+// until the returned function is called. The returned function is idempotent.
+func sampleHeap(peak *uint64) func() {
+	var (
+		observed atomic.Uint64
+		wg       sync.WaitGroup
+		once     sync.Once
+	)
+	sample := func() {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > observed.Load() {
+			observed.Store(stats.HeapAlloc)
+		}
+	}
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sample()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			sample()
+			*peak = observed.Load()
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package reassemble
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// ChannelBankState is a snapshot of the channels which are still buffered in the channel bank
+// after all frames included up to and including L1Block have been processed.
+type ChannelBankState struct {
+	L1Block  uint64            `json:"l1_block"`
+	Channels []BufferedChannel `json:"channels"`
+}
+
+// BufferedChannel is a channel that is open or pending, i.e. not ready to be read.
+type BufferedChannel struct {
+	ID        derive.ChannelID    `json:"id"`
+	OpenBlock uint64              `json:"open_block"`
+	Size      uint64              `json:"size"`
+	LastSeen  bool                `json:"last_frame_seen"`
+	TimedOut  bool                `json:"timed_out"`
+	Frames    []FrameWithMetadata `json:"frames"`
+}
+
+// ChannelBank replays all frames of the input directory which were included up to and including l1Block
+// and returns the channels that are buffered but not ready at that point.
+// If l1Block is zero, all frames of the cache are processed.
+// Channels which would have been pruned because of the channel timeout are kept, but marked as timed out.
+func ChannelBank(config Config, rollupCfg *rollup.Config, l1Block uint64) ChannelBankState {
+	spec := rollup.NewChainSpec(rollupCfg)
+	frames, err := loadFrames(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	state := ChannelBankState{L1Block: l1Block}
+	if l1Block == 0 && len(frames) > 0 {
+		state.L1Block = frames[len(frames)-1].InclusionBlock
+	}
+
+	var ids []derive.ChannelID
+	framesByChannel := make(map[derive.ChannelID][]FrameWithMetadata)
+	for _, frame := range frames {
+		if frame.InclusionBlock > state.L1Block {
+			continue
+		}
+		if _, ok := framesByChannel[frame.Frame.ID]; !ok {
+			ids = append(ids, frame.Frame.ID)
+		}
+		framesByChannel[frame.Frame.ID] = append(framesByChannel[frame.Frame.ID], frame)
+	}
+
+	for _, id := range ids {
+		frames := framesByChannel[id]
+		ch := derive.NewChannel(id, eth.L1BlockRef{Number: frames[0].InclusionBlock})
+		lastSeen := false
+		for _, frame := range frames {
+			// Invalid frames are dropped by the channel, just like in the channel bank.
+			_ = ch.AddFrame(frame.Frame, eth.L1BlockRef{Number: frame.InclusionBlock, Time: frame.Timestamp})
+			lastSeen = lastSeen || frame.Frame.IsLast
+		}
+		if ch.IsReady() {
+			continue
+		}
+		timeout := spec.ChannelTimeout(ch.HighestBlock().Time)
+		state.Channels = append(state.Channels, BufferedChannel{
+			ID:        id,
+			OpenBlock: ch.OpenBlockNumber(),
+			Size:      ch.Size(),
+			LastSeen:  lastSeen,
+			TimedOut:  ch.OpenBlockNumber()+timeout < state.L1Block,
+			Frames:    frames,
+		})
+	}
+	sort.SliceStable(state.Channels, func(i, j int) bool {
+		return state.Channels[i].OpenBlock < state.Channels[j].OpenBlock
+	})
+	return state
+}
+
+// WriteChannelBankState writes the channel bank state as JSON to the given file.
+func WriteChannelBankState(state ChannelBankState, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	return enc.Encode(state)
+}
+
+// LoadChannelBankState reads a channel bank state previously written by WriteChannelBankState.
+func LoadChannelBankState(filename string) (ChannelBankState, error) {
+	var state ChannelBankState
+	file, err := os.Open(filename)
+	if err != nil {
+		return state, err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(&state); err != nil {
+		return state, fmt.Errorf("failed to decode channel bank state %v: %w", filename, err)
+	}
+	return state, nil
+}
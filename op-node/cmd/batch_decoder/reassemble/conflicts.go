@@ -0,0 +1,141 @@
+package reassemble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ConflictPolicy determines how conflicting versions of an L1 block in the transaction cache are handled.
+// A cache built across a reorg, e.g. by separate fetch runs, can contain transactions of multiple
+// blocks with the same number.
+type ConflictPolicy string
+
+const (
+	// ConflictPolicyFail fails with an error listing the conflicting blocks.
+	ConflictPolicyFail ConflictPolicy = "fail"
+	// ConflictPolicyCanonical keeps only the transactions of the version of the block that is canonical
+	// according to the L1 RPC.
+	ConflictPolicyCanonical ConflictPolicy = "canonical"
+)
+
+func (p ConflictPolicy) String() string {
+	return string(p)
+}
+
+// ConflictPolicies lists all supported conflict policies.
+var ConflictPolicies = []ConflictPolicy{ConflictPolicyFail, ConflictPolicyCanonical}
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	for _, p := range ConflictPolicies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, expected one of %v", s, ConflictPolicies)
+}
+
+// L1HeaderClient is used to look up the canonical version of conflicting L1 blocks.
+type L1HeaderClient interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// BlockConflict describes an L1 block number for which the cache contains transactions of different blocks.
+type BlockConflict struct {
+	Number uint64
+	Hashes []common.Hash
+}
+
+func (c BlockConflict) String() string {
+	hashes := make([]string, len(c.Hashes))
+	for i, h := range c.Hashes {
+		hashes[i] = h.String()
+	}
+	return fmt.Sprintf("block %d: %s", c.Number, strings.Join(hashes, ", "))
+}
+
+// FindBlockConflicts returns all L1 block numbers for which the transactions reference more than one block hash.
+func FindBlockConflicts(txns []fetch.TransactionWithMetadata) []BlockConflict {
+	hashes := make(map[uint64][]common.Hash)
+	for _, tx := range txns {
+		known := false
+		for _, h := range hashes[tx.BlockNumber] {
+			known = known || h == tx.BlockHash
+		}
+		if !known {
+			hashes[tx.BlockNumber] = append(hashes[tx.BlockNumber], tx.BlockHash)
+		}
+	}
+	var out []BlockConflict
+	for number, hs := range hashes {
+		if len(hs) > 1 {
+			out = append(out, BlockConflict{Number: number, Hashes: hs})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	return out
+}
+
+// resolveBlockConflicts removes duplicate copies of the same transaction and handles conflicting versions
+// of L1 blocks according to the configured policy.
+func resolveBlockConflicts(config Config, txns []fetch.TransactionWithMetadata) ([]fetch.TransactionWithMetadata, error) {
+	type key struct {
+		block common.Hash
+		tx    common.Hash
+	}
+	seen := make(map[key]struct{})
+	deduped := txns[:0]
+	for _, tx := range txns {
+		k := key{block: tx.BlockHash, tx: tx.Tx.Hash()}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		deduped = append(deduped, tx)
+	}
+
+	conflicts := FindBlockConflicts(deduped)
+	if len(conflicts) == 0 {
+		return deduped, nil
+	}
+	switch config.ConflictPolicy {
+	case ConflictPolicyCanonical:
+		if config.L1 == nil {
+			return nil, errors.New("an L1 RPC is required to resolve conflicting L1 blocks in the cache")
+		}
+		canonical := make(map[uint64]common.Hash)
+		for _, c := range conflicts {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			header, err := config.L1.HeaderByNumber(ctx, new(big.Int).SetUint64(c.Number))
+			cancel()
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch canonical L1 block %d: %w", c.Number, err)
+			}
+			canonical[c.Number] = header.Hash()
+			fmt.Fprintf(config.logOutput(), "Resolved conflicting versions of L1 %v, canonical block is %v\n", c, header.Hash())
+		}
+		var out []fetch.TransactionWithMetadata
+		for _, tx := range deduped {
+			if h, ok := canonical[tx.BlockNumber]; ok && h != tx.BlockHash {
+				continue
+			}
+			out = append(out, tx)
+		}
+		return out, nil
+	default:
+		msgs := make([]string, len(conflicts))
+		for i, c := range conflicts {
+			msgs[i] = c.String()
+		}
+		return nil, fmt.Errorf("cache contains conflicting versions of L1 blocks, refetch the range or resolve them with the canonical policy: %s",
+			strings.Join(msgs, "; "))
+	}
+}
@@ -0,0 +1,128 @@
+package reassemble
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// ChannelCost is the estimated L1 cost of posting the frames of a channel.
+type ChannelCost struct {
+	ID           derive.ChannelID `json:"id"`
+	Transactions int              `json:"transactions"`
+	// CalldataBytes and BlobBytes are the bytes posted as calldata and in blobs. Blobs are always
+	// posted in full, so BlobBytes includes their unused capacity.
+	CalldataBytes uint64 `json:"calldata_bytes"`
+	BlobBytes     uint64 `json:"blob_bytes"`
+	// ExecutionGas is the intrinsic gas of the transactions, BlobGas the blob gas they consume.
+	ExecutionGas uint64 `json:"execution_gas"`
+	BlobGas      uint64 `json:"blob_gas"`
+	// MaxFee is an upper bound of the fees paid, in wei: the gas priced at the fee caps of the transactions.
+	MaxFee *big.Int `json:"max_fee_wei"`
+}
+
+// CostReport is the estimated L1 cost of every channel of the cache and their total.
+type CostReport struct {
+	Channels      []ChannelCost `json:"channels"`
+	CalldataBytes uint64        `json:"calldata_bytes"`
+	BlobBytes     uint64        `json:"blob_bytes"`
+	ExecutionGas  uint64        `json:"execution_gas"`
+	BlobGas       uint64        `json:"blob_gas"`
+	MaxFee        *big.Int      `json:"max_fee_wei"`
+}
+
+// ChannelCosts estimates the L1 cost of the channels of the transactions from the cached transactions
+// alone, which don't include receipts or the base fees of their blocks:
+//   - the execution gas of a transaction is its intrinsic gas, 21000 plus 4 gas per zero byte and 16 gas
+//     per non-zero byte of calldata. Batcher transactions are plain transfers to the inbox, so that is
+//     the gas they use, apart from the EIP-7623 calldata floor.
+//   - the blob gas of a transaction is 131072 per blob.
+//   - the fee is bounded by the gas priced at the fee cap, and the blob gas at the blob fee cap, of the
+//     transaction, since the effective gas prices never exceed them.
+//
+// The cost of a transaction carrying frames of several channels is split between them in proportion to
+// the size of their frames. Transactions without any valid frames are not attributed to a channel.
+func ChannelCosts(txns []fetch.TransactionWithMetadata) CostReport {
+	report := CostReport{MaxFee: new(big.Int)}
+	index := make(map[derive.ChannelID]int)
+	for _, txm := range txns {
+		weights := make(map[derive.ChannelID]uint64)
+		var ids []derive.ChannelID
+		var total uint64
+		for _, frame := range txm.Frames {
+			if _, ok := weights[frame.ID]; !ok {
+				ids = append(ids, frame.ID)
+			}
+			size := uint64(len(frame.Data)) + derive.FrameV0OverHeadSize
+			weights[frame.ID] += size
+			total += size
+		}
+		if total == 0 {
+			continue
+		}
+		cost := txCost(txm.Tx)
+		for _, id := range ids {
+			i, ok := index[id]
+			if !ok {
+				i = len(report.Channels)
+				index[id] = i
+				report.Channels = append(report.Channels, ChannelCost{ID: id, MaxFee: new(big.Int)})
+			}
+			w := weights[id]
+			ch := &report.Channels[i]
+			ch.Transactions++
+			ch.CalldataBytes += cost.CalldataBytes * w / total
+			ch.BlobBytes += cost.BlobBytes * w / total
+			ch.ExecutionGas += cost.ExecutionGas * w / total
+			ch.BlobGas += cost.BlobGas * w / total
+			fee := new(big.Int).Mul(cost.MaxFee, new(big.Int).SetUint64(w))
+			ch.MaxFee.Add(ch.MaxFee, fee.Div(fee, new(big.Int).SetUint64(total)))
+		}
+		report.CalldataBytes += cost.CalldataBytes
+		report.BlobBytes += cost.BlobBytes
+		report.ExecutionGas += cost.ExecutionGas
+		report.BlobGas += cost.BlobGas
+		report.MaxFee.Add(report.MaxFee, cost.MaxFee)
+	}
+	return report
+}
+
+// txCost estimates the cost of a single batcher transaction, see ChannelCosts.
+func txCost(tx *types.Transaction) ChannelCost {
+	cost := ChannelCost{
+		CalldataBytes: uint64(len(tx.Data())),
+		ExecutionGas:  params.TxGas,
+		BlobGas:       tx.BlobGas(),
+	}
+	cost.BlobBytes = cost.BlobGas // a blob consumes one unit of blob gas per byte
+	for _, b := range tx.Data() {
+		if b == 0 {
+			cost.ExecutionGas += params.TxDataZeroGas
+		} else {
+			cost.ExecutionGas += params.TxDataNonZeroGasEIP2028
+		}
+	}
+	cost.MaxFee = new(big.Int).Mul(new(big.Int).SetUint64(cost.ExecutionGas), tx.GasFeeCap())
+	if cost.BlobGas > 0 {
+		blobFee := new(big.Int).Mul(new(big.Int).SetUint64(cost.BlobGas), tx.BlobGasFeeCap())
+		cost.MaxFee.Add(cost.MaxFee, blobFee)
+	}
+	return cost
+}
+
+// WriteCostReport writes the cost report as JSON to the given file.
+func WriteCostReport(report CostReport, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,79 @@
+package reassemble
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// FrameSummary describes a single frame of frame-encoded transaction data.
+type FrameSummary struct {
+	ID          derive.ChannelID `json:"id"`
+	FrameNumber uint16           `json:"frame_number"`
+	DataLength  int              `json:"data_length"`
+	IsLast      bool             `json:"is_last"`
+}
+
+// DecodeFrames parses the frames of raw batcher transaction data, i.e. calldata or the data of a blob,
+// starting with the derivation version byte.
+func DecodeFrames(data []byte) ([]FrameSummary, error) {
+	frames, err := derive.ParseFrames(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid frame data: %w", err)
+	}
+	out := make([]FrameSummary, len(frames))
+	for i, frame := range frames {
+		out[i] = FrameSummary{
+			ID:          frame.ID,
+			FrameNumber: frame.FrameNumber,
+			DataLength:  len(frame.Data),
+			IsLast:      frame.IsLast,
+		}
+	}
+	return out, nil
+}
+
+// BlobFrames holds the frames decoded from a blob, or the error if it doesn't contain valid frame data.
+type BlobFrames struct {
+	fetch.BlockBlob
+	Frames []FrameSummary `json:"frames"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// DecodeBlobs decodes the frames of each blob.
+func DecodeBlobs(blobs []fetch.BlockBlob) []BlobFrames {
+	out := make([]BlobFrames, len(blobs))
+	for i, blob := range blobs {
+		out[i].BlockBlob = blob
+		frames, err := DecodeFrames(blob.Data)
+		if err != nil {
+			out[i].Error = err.Error()
+		}
+		out[i].Frames = frames
+	}
+	return out
+}
+
+// FindBlobBlock looks up the L1 block of the blob with the given versioned hash in the transaction cache,
+// which is either a local directory or an s3://<bucket>/<prefix> URL, see OpenTxSource.
+func FindBlobBlock(in string, versionedHash common.Hash) (uint64, error) {
+	src, err := OpenTxSource(in)
+	if err != nil {
+		return 0, err
+	}
+	txns, err := loadSourceTransactions(context.Background(), src, common.Address{})
+	if err != nil {
+		return 0, err
+	}
+	for _, tx := range txns {
+		for _, hash := range tx.Tx.BlobHashes() {
+			if hash == versionedHash {
+				return tx.BlockNumber, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("blob %v not found in transaction cache %v", versionedHash, in)
+}
@@ -0,0 +1,52 @@
+package reassemble
+
+import "github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+
+// ForceCloseCheck describes the state of the frames of a channel which would be passed to
+// derive.ForceCloseTxData, without crafting the force-close transaction data.
+type ForceCloseCheck struct {
+	ID derive.ChannelID `json:"id"`
+	// Frames is the number of frames of the channel.
+	Frames int `json:"frames"`
+	// Closed reports whether any frame is marked as the last frame of the channel.
+	Closed bool `json:"closed"`
+	// LastFrameIsLast reports whether the frame with the highest frame number is marked as the last frame.
+	LastFrameIsLast bool `json:"last_frame_is_last"`
+	// HighestFrameNumber is the highest frame number of the frames.
+	HighestFrameNumber uint16 `json:"highest_frame_number"`
+	// MissingFrames lists the frame numbers below the closing frame, or the highest frame of an
+	// open channel, which are not present.
+	MissingFrames []uint16 `json:"missing_frames"`
+}
+
+// CheckForceClose inspects the frames of the channel with the given ID.
+func CheckForceClose(id derive.ChannelID, frames []derive.Frame) ForceCloseCheck {
+	check := ForceCloseCheck{ID: id, Frames: len(frames), MissingFrames: []uint16{}}
+	if len(frames) == 0 {
+		return check
+	}
+	frameNumbers := make(map[uint16]struct{})
+	closeNumber := uint16(0)
+	var highest derive.Frame
+	for i, frame := range frames {
+		if !check.Closed && frame.IsLast {
+			closeNumber = frame.FrameNumber
+		}
+		check.Closed = check.Closed || frame.IsLast
+		frameNumbers[frame.FrameNumber] = struct{}{}
+		if i == 0 || frame.FrameNumber > highest.FrameNumber {
+			highest = frame
+		}
+	}
+	check.HighestFrameNumber = highest.FrameNumber
+	check.LastFrameIsLast = highest.IsLast
+	if !check.Closed {
+		closeNumber = highest.FrameNumber
+	}
+	for i := uint16(0); i < closeNumber; i++ {
+		if _, ok := frameNumbers[i]; !ok {
+			check.MissingFrames = append(check.MissingFrames, i)
+		}
+	}
+	return check
+}
@@ -0,0 +1,64 @@
+package reassemble
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// IncompleteChannel describes a channel which never became ready, e.g. because a frame is missing.
+type IncompleteChannel struct {
+	ID     derive.ChannelID `json:"id"`
+	Frames int              `json:"frames"`
+	// HighestFrameNumber is the highest frame number received for the channel.
+	HighestFrameNumber uint16 `json:"highest_frame_number"`
+	// MissingFrames are the frame numbers below the highest one which were not received.
+	MissingFrames []uint16 `json:"missing_frames"`
+	LastSeen      bool     `json:"last_frame_seen"`
+	// Bytes is the total size of the received frame data.
+	Bytes      uint64 `json:"bytes"`
+	FirstBlock uint64 `json:"first_inclusion_block"`
+	LastBlock  uint64 `json:"last_inclusion_block"`
+}
+
+// newIncompleteChannel reports the frames which were received for the channel.
+func newIncompleteChannel(ch ChannelWithMetadata) IncompleteChannel {
+	out := IncompleteChannel{ID: ch.ID, Frames: len(ch.Frames), MissingFrames: []uint16{}}
+	received := make(map[uint16]bool)
+	for i, frame := range ch.Frames {
+		received[frame.Frame.FrameNumber] = true
+		if frame.Frame.FrameNumber > out.HighestFrameNumber {
+			out.HighestFrameNumber = frame.Frame.FrameNumber
+		}
+		out.LastSeen = out.LastSeen || frame.Frame.IsLast
+		out.Bytes += uint64(len(frame.Frame.Data))
+		if i == 0 || frame.InclusionBlock < out.FirstBlock {
+			out.FirstBlock = frame.InclusionBlock
+		}
+		if frame.InclusionBlock > out.LastBlock {
+			out.LastBlock = frame.InclusionBlock
+		}
+	}
+	for n := uint16(0); n < out.HighestFrameNumber; n++ {
+		if !received[n] {
+			out.MissingFrames = append(out.MissingFrames, n)
+		}
+	}
+	return out
+}
+
+// WriteIncompleteChannels writes the report of incomplete channels as JSON to the given file.
+func WriteIncompleteChannels(channels []IncompleteChannel, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if channels == nil {
+		channels = []IncompleteChannel{}
+	}
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	return enc.Encode(channels)
+}
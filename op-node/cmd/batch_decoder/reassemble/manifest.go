@@ -0,0 +1,35 @@
+package reassemble
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// checkManifest compares the manifest written by fetch to the input cache with the configuration
+// used to reassemble it, and returns a warning for every mismatch, e.g. a cache fetched for the
+// batch inbox of another chain. Caches without a manifest, like those in S3, are not checked.
+func checkManifest(config Config, rollupCfg *rollup.Config) ([]string, error) {
+	if strings.HasPrefix(config.InDirectory, "s3://") {
+		return nil, nil
+	}
+	m, err := fetch.LoadManifest(config.InDirectory)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	if config.BatchInbox != (common.Address{}) && m.BatchInbox != config.BatchInbox {
+		warnings = append(warnings, fmt.Sprintf("cache was fetched for batch inbox %v, but reassembling for %v", m.BatchInbox, config.BatchInbox))
+	}
+	if rollupCfg != nil && rollupCfg.L1ChainID != nil && m.ChainID != rollupCfg.L1ChainID.Uint64() {
+		warnings = append(warnings, fmt.Sprintf("cache was fetched from L1 chain %d, but the rollup config is for L1 chain %v", m.ChainID, rollupCfg.L1ChainID))
+	}
+	return warnings, nil
+}
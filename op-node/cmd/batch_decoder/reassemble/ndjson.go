@@ -0,0 +1,70 @@
+package reassemble
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// BatchSummary describes a single L2 block of a decoded batch. Span batches are expanded into
+// one summary per block.
+type BatchSummary struct {
+	ChannelID derive.ChannelID `json:"channel_id"`
+	BatchType int              `json:"batch_type"`
+	Timestamp uint64           `json:"timestamp"`
+	Epoch     uint64           `json:"epoch"`
+	TxCount   int              `json:"tx_count"`
+	// BlockCount is the number of L2 blocks of the batch the block belongs to, and Index its
+	// position in the batch. Both are 1 and 0 for singular batches.
+	BlockCount int `json:"block_count"`
+	Index      int `json:"index"`
+}
+
+// ChannelBatchSummaries returns the summaries of the blocks of all successfully decoded batches of the channel.
+func ChannelBatchSummaries(ch ChannelWithMetadata) []BatchSummary {
+	var out []BatchSummary
+	for _, batch := range ch.Batches {
+		switch b := batch.(type) {
+		case *derive.SingularBatch:
+			if b == nil {
+				continue
+			}
+			out = append(out, BatchSummary{
+				ChannelID:  ch.ID,
+				BatchType:  derive.SingularBatchType,
+				Timestamp:  b.Timestamp,
+				Epoch:      uint64(b.EpochNum),
+				TxCount:    len(b.Transactions),
+				BlockCount: 1,
+			})
+		case *derive.SpanBatch:
+			if b == nil {
+				continue
+			}
+			for i, el := range b.Batches {
+				out = append(out, BatchSummary{
+					ChannelID:  ch.ID,
+					BatchType:  derive.SpanBatchType,
+					Timestamp:  el.Timestamp,
+					Epoch:      uint64(el.EpochNum),
+					TxCount:    len(el.Transactions),
+					BlockCount: len(b.Batches),
+					Index:      i,
+				})
+			}
+		}
+	}
+	return out
+}
+
+// writeBatchSummaries writes the batch summaries of the channel to w as newline-delimited JSON.
+func writeBatchSummaries(w io.Writer, ch ChannelWithMetadata) error {
+	enc := json.NewEncoder(w)
+	for _, summary := range ChannelBatchSummaries(ch) {
+		if err := enc.Encode(summary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
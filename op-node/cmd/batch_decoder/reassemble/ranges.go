@@ -0,0 +1,95 @@
+package reassemble
+
+import (
+	"fmt"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// BatchRange describes the L2 blocks covered by a single batch decoded from a channel.
+type BatchRange struct {
+	ChannelID  derive.ChannelID `json:"channel_id"`
+	BatchType  int              `json:"batch_type"`
+	StartBlock uint64           `json:"start_block"`
+	EndBlock   uint64           `json:"end_block"` // inclusive
+}
+
+// TxBatchRanges lists the channels an L1 transaction contributed frames to and the
+// L2 block ranges of the batches decoded from those channels.
+type TxBatchRanges struct {
+	TxHash   common.Hash        `json:"transaction_hash"`
+	Channels []derive.ChannelID `json:"channels"`
+	Ranges   []BatchRange       `json:"ranges"`
+}
+
+// BatchRangesByTx loads the frames of the cache, resolves the channels which contain frames
+// submitted in the given L1 transaction and returns the L2 block ranges of their batches.
+func BatchRangesByTx(config Config, rollupCfg *rollup.Config, txHash common.Hash) (TxBatchRanges, error) {
+	result := TxBatchRanges{TxHash: txHash}
+	frames, err := loadFrames(config)
+	if err != nil {
+		return result, err
+	}
+	framesByChannel := make(map[derive.ChannelID][]FrameWithMetadata)
+	inTx := make(map[derive.ChannelID]bool)
+	for _, frame := range frames {
+		if frame.TxHash == txHash && !inTx[frame.Frame.ID] {
+			inTx[frame.Frame.ID] = true
+			result.Channels = append(result.Channels, frame.Frame.ID)
+		}
+		framesByChannel[frame.Frame.ID] = append(framesByChannel[frame.Frame.ID], frame)
+	}
+	if len(result.Channels) == 0 {
+		return result, fmt.Errorf("no frames found for transaction %v in %v", txHash, config.InDirectory)
+	}
+	for _, id := range result.Channels {
+		ch := processFrames(config, rollupCfg, id, framesByChannel[id])
+		ranges, err := ChannelBatchRanges(rollupCfg, ch)
+		if err != nil {
+			return result, err
+		}
+		result.Ranges = append(result.Ranges, ranges...)
+	}
+	return result, nil
+}
+
+// ChannelBatchRanges returns the L2 block range of every successfully decoded batch of the channel.
+func ChannelBatchRanges(rollupCfg *rollup.Config, ch ChannelWithMetadata) ([]BatchRange, error) {
+	var out []BatchRange
+	for _, batch := range ch.Batches {
+		var (
+			timestamp  uint64
+			blockCount uint64
+		)
+		switch b := batch.(type) {
+		case *derive.SingularBatch:
+			if b == nil {
+				continue
+			}
+			timestamp, blockCount = b.GetTimestamp(), 1
+		case *derive.SpanBatch:
+			if b == nil {
+				continue
+			}
+			timestamp, blockCount = b.GetTimestamp(), uint64(b.GetBlockCount())
+		default:
+			continue
+		}
+		if blockCount == 0 {
+			continue
+		}
+		start, err := rollupCfg.TargetBlockNumber(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch timestamp in channel %v: %w", ch.ID, err)
+		}
+		out = append(out, BatchRange{
+			ChannelID:  ch.ID,
+			BatchType:  int(batch.GetBatchType()),
+			StartBlock: start,
+			EndBlock:   start + blockCount - 1,
+		})
+	}
+	return out, nil
+}
@@ -1,6 +1,8 @@
 package reassemble
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,31 +13,47 @@ import (
 	"sort"
 
 	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/metrics"
 	"github.com/ethereum-optimism/optimism/op-node/rollup"
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
 	"github.com/ethereum-optimism/optimism/op-service/eth"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"golang.org/x/sync/errgroup"
 )
 
 type ChannelWithMetadata struct {
-	ID             derive.ChannelID         `json:"id"`
-	IsReady        bool                     `json:"is_ready"`
-	InvalidFrames  bool                     `json:"invalid_frames"`
-	InvalidBatches bool                     `json:"invalid_batches"`
-	Frames         []FrameWithMetadata      `json:"frames"`
-	Batches        []derive.Batch           `json:"batches"`
-	BatchTypes     []int                    `json:"batch_types"`
-	ComprAlgos     []derive.CompressionAlgo `json:"compr_algos"`
+	ID                derive.ChannelID         `json:"id"`
+	IsReady           bool                     `json:"is_ready"`
+	InvalidFrames     bool                     `json:"invalid_frames"`
+	InvalidBatches    bool                     `json:"invalid_batches"`
+	Frames            []FrameWithMetadata      `json:"frames"`
+	Batches           []derive.Batch           `json:"batches"`
+	BatchTypes        []int                    `json:"batch_types"`
+	ComprAlgos        []derive.CompressionAlgo `json:"compr_algos"`
+	DecompressedBytes uint64                   `json:"decompressed_bytes"`
+	MixedTransports   bool                     `json:"mixed_transports"`
 }
 
+// Data availability transports of a frame
+const (
+	TransportCalldata = "calldata"
+	TransportBlob     = "blob"
+)
+
 type FrameWithMetadata struct {
 	TxHash         common.Hash  `json:"transaction_hash"`
 	InclusionBlock uint64       `json:"inclusion_block"`
 	Timestamp      uint64       `json:"timestamp"`
 	BlockHash      common.Hash  `json:"block_hash"`
+	Transport      string       `json:"transport"`
 	Frame          derive.Frame `json:"frame"`
 }
 
+// loadConcurrency is the number of transaction files which are read concurrently.
+const loadConcurrency = 32
+
 type Config struct {
 	BatchInbox    common.Address
 	InDirectory   string
@@ -43,20 +61,92 @@ type Config struct {
 	L2ChainID     *big.Int
 	L2GenesisTime uint64
 	L2BlockTime   uint64
+	// Metrics records reassembly results. Defaults to no-op metrics when nil.
+	Metrics metrics.Metricer
+	// ConflictPolicy determines how conflicting versions of an L1 block in the cache are handled.
+	ConflictPolicy ConflictPolicy
+	// L1 is used to look up canonical L1 blocks with ConflictPolicyCanonical.
+	L1 L1HeaderClient
+	// BatchSummaries, if set, receives a summary of every decoded block as newline-delimited JSON.
+	BatchSummaries io.Writer
+	// IncompleteReport, if set, is the file to write a report of the channels which never became ready to.
+	IncompleteReport string
+	// CostReport, if set, is the file to write the estimated L1 cost of every channel to, see ChannelCosts.
+	CostReport string
+	// Log receives the log output of the reassembly, e.g. warnings and invalid channels. Defaults to stdout.
+	Log io.Writer
+}
+
+// logOutput returns the writer the log output of the reassembly is printed to.
+func (c Config) logOutput() io.Writer {
+	if c.Log == nil {
+		return os.Stdout
+	}
+	return c.Log
+}
+
+// RollupConfig returns a minimal rollup config built from the L2 chain parameters of the config, for
+// chains which are neither in the superchain-registry nor given by a rollup config file. It activates
+// no hardforks, so channels are decoded with the pre-Fjord size limit and without brotli support.
+func (c Config) RollupConfig() *rollup.Config {
+	return &rollup.Config{
+		Genesis:           rollup.Genesis{L2Time: c.L2GenesisTime},
+		BlockTime:         c.L2BlockTime,
+		L2ChainID:         c.L2ChainID,
+		BatchInboxAddress: c.BatchInbox,
+	}
 }
 
+// LoadFrames loads the frames of all transactions of the input directory which were submitted to the
+// inbox. The frames are ordered deterministically by L1 block number and transaction index, independent of
+// the order in which the cache is listed, and within a transaction by frame number.
 func LoadFrames(directory string, inbox common.Address) []FrameWithMetadata {
 	txns := loadTransactions(directory, inbox)
+	sortTransactions(txns)
+	return transactionsToFrames(txns)
+}
+
+// loadFrames loads the frames of the input directory like LoadFrames, after resolving conflicting
+// versions of L1 blocks in the cache according to the configured policy.
+func loadFrames(config Config) ([]FrameWithMetadata, error) {
+	txns, err := loadResolvedTransactions(config)
+	if err != nil {
+		return nil, err
+	}
+	return transactionsToFrames(txns), nil
+}
+
+// loadResolvedTransactions loads the sorted transactions of the input directory, after resolving
+// conflicting versions of L1 blocks in the cache according to the configured policy.
+func loadResolvedTransactions(config Config) ([]fetch.TransactionWithMetadata, error) {
+	txns := loadTransactions(config.InDirectory, config.BatchInbox)
+	txns, err := resolveBlockConflicts(config, txns)
+	if err != nil {
+		return nil, err
+	}
+	sortTransactions(txns)
+	return txns, nil
+}
+
+func sortTransactions(txns []fetch.TransactionWithMetadata) {
 	// Sort first by block number then by transaction index inside the block number range.
 	// This is to match the order they are processed in derivation.
+	// Transactions of conflicting versions of a block share both, so the block and transaction hashes
+	// break ties to make the order independent of the order the cache was listed in.
 	sort.Slice(txns, func(i, j int) bool {
-		if txns[i].BlockNumber == txns[j].BlockNumber {
-			return txns[i].TxIndex < txns[j].TxIndex
-		} else {
-			return txns[i].BlockNumber < txns[j].BlockNumber
+		a, b := txns[i], txns[j]
+		if a.BlockNumber != b.BlockNumber {
+			return a.BlockNumber < b.BlockNumber
 		}
+		if a.TxIndex != b.TxIndex {
+			return a.TxIndex < b.TxIndex
+		}
+		if a.BlockHash != b.BlockHash {
+			return bytes.Compare(a.BlockHash[:], b.BlockHash[:]) < 0
+		}
+		ha, hb := a.Tx.Hash(), b.Tx.Hash()
+		return bytes.Compare(ha[:], hb[:]) < 0
 	})
-	return transactionsToFrames(txns)
 }
 
 // Channels loads all transactions from the given input directory that are submitted to the
@@ -66,17 +156,55 @@ func Channels(config Config, rollupCfg *rollup.Config) {
 	if err := os.MkdirAll(config.OutDirectory, 0750); err != nil {
 		log.Fatal(err)
 	}
-	frames := LoadFrames(config.InDirectory, config.BatchInbox)
+	warnings, err := checkManifest(config, rollupCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(config.logOutput(), "Warning: %v\n", warning)
+	}
+	txns, err := loadResolvedTransactions(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	frames := transactionsToFrames(txns)
+	// Channels are processed in the order of their first frame, so batch summaries are written in L1 order.
+	var ids []derive.ChannelID
 	framesByChannel := make(map[derive.ChannelID][]FrameWithMetadata)
 	for _, frame := range frames {
+		if _, ok := framesByChannel[frame.Frame.ID]; !ok {
+			ids = append(ids, frame.Frame.ID)
+		}
 		framesByChannel[frame.Frame.ID] = append(framesByChannel[frame.Frame.ID], frame)
 	}
-	for id, frames := range framesByChannel {
-		ch := processFrames(config, rollupCfg, id, frames)
+	var incomplete []IncompleteChannel
+	for _, id := range ids {
+		ch := processFrames(config, rollupCfg, id, framesByChannel[id])
+		if !ch.IsReady {
+			incomplete = append(incomplete, newIncompleteChannel(ch))
+		}
 		filename := path.Join(config.OutDirectory, fmt.Sprintf("%s.json", id.String()))
 		if err := writeChannel(ch, filename); err != nil {
 			log.Fatal(err)
 		}
+		if config.BatchSummaries != nil {
+			if err := writeBatchSummaries(config.BatchSummaries, ch); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if config.IncompleteReport != "" {
+		if err := WriteIncompleteChannels(incomplete, config.IncompleteReport); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(config.logOutput(), "Wrote report of %v incomplete channels to %v\n", len(incomplete), config.IncompleteReport)
+	}
+	if config.CostReport != "" {
+		report := ChannelCosts(txns)
+		if err := WriteCostReport(report, config.CostReport); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(config.logOutput(), "Wrote estimated L1 cost of %v channels to %v\n", len(report.Channels), config.CostReport)
 	}
 }
 
@@ -91,26 +219,42 @@ func writeChannel(ch ChannelWithMetadata, filename string) error {
 }
 
 func processFrames(cfg Config, rollupCfg *rollup.Config, id derive.ChannelID, frames []FrameWithMetadata) ChannelWithMetadata {
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.NoopMetrics
+	}
 	spec := rollup.NewChainSpec(rollupCfg)
 	ch := derive.NewChannel(id, eth.L1BlockRef{Number: frames[0].InclusionBlock})
 	invalidFrame := false
 
+	// Frames of one channel may be split across calldata and blob transactions, e.g. across the Ecotone upgrade.
+	// They are merged by L1 inclusion order regardless of their transport.
+	mixedTransports := false
+	for _, frame := range frames {
+		if frame.Transport != frames[0].Transport {
+			mixedTransports = true
+			fmt.Fprintf(cfg.logOutput(), "Channel %v mixes calldata and blob frames\n", id.String())
+			break
+		}
+	}
+
 	for _, frame := range frames {
 		if ch.IsReady() {
-			fmt.Printf("Channel %v is ready despite having more frames\n", id.String())
+			fmt.Fprintf(cfg.logOutput(), "Channel %v is ready despite having more frames\n", id.String())
 			invalidFrame = true
 			break
 		}
 		if err := ch.AddFrame(frame.Frame, eth.L1BlockRef{Number: frame.InclusionBlock, Time: frame.Timestamp}); err != nil {
-			fmt.Printf("Error adding to channel %v. Err: %v\n", id.String(), err)
+			fmt.Fprintf(cfg.logOutput(), "Error adding to channel %v. Err: %v\n", id.String(), err)
+			cfg.Metrics.RecordDecodeError(metrics.ErrChannelFrame)
 			invalidFrame = true
 		}
 	}
 
 	var (
-		batches    []derive.Batch
-		batchTypes []int
-		comprAlgos []derive.CompressionAlgo
+		batches           []derive.Batch
+		batchTypes        []int
+		comprAlgos        []derive.CompressionAlgo
+		decompressedBytes uint64
 	)
 
 	invalidBatches := false
@@ -119,10 +263,14 @@ func processFrames(cfg Config, rollupCfg *rollup.Config, id derive.ChannelID, fr
 		if err == nil {
 			for batchData, err := br(); err != io.EOF; batchData, err = br() {
 				if err != nil {
-					fmt.Printf("Error reading batchData for channel %v. Err: %v\n", id.String(), err)
+					fmt.Fprintf(cfg.logOutput(), "Error reading batchData for channel %v. Err: %v\n", id.String(), err)
+					cfg.Metrics.RecordDecodeError(metrics.ErrBatchData)
 					invalidBatches = true
 				} else {
 					comprAlgos = append(comprAlgos, batchData.ComprAlgo)
+					if encoded, err := rlp.EncodeToBytes(batchData); err == nil {
+						decompressedBytes += uint64(len(encoded))
+					}
 					batchType := batchData.GetBatchType()
 					batchTypes = append(batchTypes, int(batchType))
 					switch batchType {
@@ -130,7 +278,8 @@ func processFrames(cfg Config, rollupCfg *rollup.Config, id derive.ChannelID, fr
 						singularBatch, err := derive.GetSingularBatch(batchData)
 						if err != nil {
 							invalidBatches = true
-							fmt.Printf("Error converting singularBatch from batchData for channel %v. Err: %v\n", id.String(), err)
+							fmt.Fprintf(cfg.logOutput(), "Error converting singularBatch from batchData for channel %v. Err: %v\n", id.String(), err)
+							cfg.Metrics.RecordDecodeError(metrics.ErrSingularBatch)
 						}
 						// singularBatch will be nil when errored
 						batches = append(batches, singularBatch)
@@ -138,43 +287,60 @@ func processFrames(cfg Config, rollupCfg *rollup.Config, id derive.ChannelID, fr
 						spanBatch, err := derive.DeriveSpanBatch(batchData, cfg.L2BlockTime, cfg.L2GenesisTime, cfg.L2ChainID)
 						if err != nil {
 							invalidBatches = true
-							fmt.Printf("Error deriving spanBatch from batchData for channel %v. Err: %v\n", id.String(), err)
+							fmt.Fprintf(cfg.logOutput(), "Error deriving spanBatch from batchData for channel %v. Err: %v\n", id.String(), err)
+							cfg.Metrics.RecordDecodeError(metrics.ErrSpanBatch)
 						}
 						// spanBatch will be nil when errored
 						batches = append(batches, spanBatch)
 					default:
-						fmt.Printf("unrecognized batch type: %d for channel %v.\n", batchData.GetBatchType(), id.String())
+						fmt.Fprintf(cfg.logOutput(), "unrecognized batch type: %d for channel %v.\n", batchData.GetBatchType(), id.String())
+						cfg.Metrics.RecordDecodeError(metrics.ErrUnknownBatchType)
 					}
 				}
 			}
 		} else {
-			fmt.Printf("Error creating batch reader for channel %v. Err: %v\n", id.String(), err)
+			fmt.Fprintf(cfg.logOutput(), "Error creating batch reader for channel %v. Err: %v\n", id.String(), err)
+			cfg.Metrics.RecordDecodeError(metrics.ErrBatchReader)
 		}
 	} else {
-		fmt.Printf("Channel %v is not ready\n", id.String())
+		fmt.Fprintf(cfg.logOutput(), "Channel %v is not ready\n", id.String())
 	}
 
+	cfg.Metrics.RecordChannelReassembled(ch.IsReady())
 	return ChannelWithMetadata{
-		ID:             id,
-		Frames:         frames,
-		IsReady:        ch.IsReady(),
-		InvalidFrames:  invalidFrame,
-		InvalidBatches: invalidBatches,
-		Batches:        batches,
-		BatchTypes:     batchTypes,
-		ComprAlgos:     comprAlgos,
+		ID:                id,
+		Frames:            frames,
+		IsReady:           ch.IsReady(),
+		InvalidFrames:     invalidFrame,
+		InvalidBatches:    invalidBatches,
+		Batches:           batches,
+		BatchTypes:        batchTypes,
+		ComprAlgos:        comprAlgos,
+		DecompressedBytes: decompressedBytes,
+		MixedTransports:   mixedTransports,
 	}
 }
 
 func transactionsToFrames(txns []fetch.TransactionWithMetadata) []FrameWithMetadata {
 	var out []FrameWithMetadata
 	for _, tx := range txns {
-		for _, frame := range tx.Frames {
+		transport := TransportCalldata
+		if tx.Tx.Type() == types.BlobTxType {
+			transport = TransportBlob
+		}
+		// Frames of a transaction are ordered by frame number, frames with the same number keep the
+		// order of the transaction data.
+		frames := append([]derive.Frame(nil), tx.Frames...)
+		sort.SliceStable(frames, func(i, j int) bool {
+			return frames[i].FrameNumber < frames[j].FrameNumber
+		})
+		for _, frame := range frames {
 			fm := FrameWithMetadata{
 				TxHash:         tx.Tx.Hash(),
 				InclusionBlock: tx.BlockNumber,
 				BlockHash:      tx.BlockHash,
 				Timestamp:      tx.BlockTime,
+				Transport:      transport,
 				Frame:          frame,
 			}
 			out = append(out, fm)
@@ -183,33 +349,50 @@ func transactionsToFrames(txns []fetch.TransactionWithMetadata) []FrameWithMetad
 	return out
 }
 
-// if inbox is the zero address, it will load all frames
-func loadTransactions(dir string, inbox common.Address) []fetch.TransactionWithMetadata {
-	files, err := os.ReadDir(dir)
+// if inbox is the zero address, it will load all frames.
+// The input is either a local cache directory or an s3://<bucket>/<prefix> URL, see OpenTxSource.
+func loadTransactions(in string, inbox common.Address) []fetch.TransactionWithMetadata {
+	src, err := OpenTxSource(in)
 	if err != nil {
 		log.Fatal(err)
 	}
-	var out []fetch.TransactionWithMetadata
-	for _, file := range files {
-		f := path.Join(dir, file.Name())
-		txm := loadTransactionsFile(f)
-		if (inbox == common.Address{} || txm.InboxAddr == inbox) && txm.ValidSender {
-			out = append(out, txm)
-		}
+	txns, err := loadSourceTransactions(context.Background(), src, inbox)
+	if err != nil {
+		log.Fatal(err)
 	}
-	return out
+	return txns
 }
 
-func loadTransactionsFile(file string) fetch.TransactionWithMetadata {
-	f, err := os.Open(file)
+// loadSourceTransactions reads and decodes all transaction files of the source concurrently.
+func loadSourceTransactions(ctx context.Context, src TxSource, inbox common.Address) ([]fetch.TransactionWithMetadata, error) {
+	names, err := src.List(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer f.Close()
-	dec := json.NewDecoder(f)
-	var txm fetch.TransactionWithMetadata
-	if err := dec.Decode(&txm); err != nil {
-		log.Fatalf("Failed to decode %v. Err: %v\n", file, err)
+	txns := make([]fetch.TransactionWithMetadata, len(names))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(loadConcurrency)
+	for i, name := range names {
+		i, name := i, name
+		g.Go(func() error {
+			data, err := src.Read(ctx, name)
+			if err != nil {
+				return fmt.Errorf("failed to read %v: %w", name, err)
+			}
+			if err := json.Unmarshal(data, &txns[i]); err != nil {
+				return fmt.Errorf("failed to decode %v: %w", name, err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	var out []fetch.TransactionWithMetadata
+	for _, txm := range txns {
+		if (inbox == common.Address{} || txm.InboxAddr == inbox) && txm.ValidSender {
+			out = append(out, txm)
+		}
 	}
-	return txm
+	return out, nil
 }
@@ -0,0 +1,692 @@
+package reassemble
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+var testInbox = common.Address{0xff, 0x10}
+
+// writeTestTx writes a cached transaction carrying the given frames to dir, using the given shard size.
+func writeTestTx(t *testing.T, dir string, blocksPerDir uint64, blockNumber uint64, txIndex uint64, frames ...derive.Frame) fetch.TransactionWithMetadata {
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID: big.NewInt(1),
+		Nonce:   blockNumber<<16 | txIndex,
+		To:      &testInbox,
+	})
+	return writeTestTxData(t, dir, blocksPerDir, blockNumber, txIndex, tx, frames...)
+}
+
+// writeTestBlobTx is like writeTestTx, but the cached transaction is a blob transaction.
+func writeTestBlobTx(t *testing.T, dir string, blocksPerDir uint64, blockNumber uint64, txIndex uint64, frames ...derive.Frame) fetch.TransactionWithMetadata {
+	tx := types.NewTx(&types.BlobTx{
+		ChainID:    uint256.NewInt(1),
+		Nonce:      blockNumber<<16 | txIndex,
+		To:         testInbox,
+		BlobHashes: make([]common.Hash, len(frames)),
+	})
+	return writeTestTxData(t, dir, blocksPerDir, blockNumber, txIndex, tx, frames...)
+}
+
+func writeTestTxData(t *testing.T, dir string, blocksPerDir uint64, blockNumber uint64, txIndex uint64, tx *types.Transaction, frames ...derive.Frame) fetch.TransactionWithMetadata {
+	txm := fetch.TransactionWithMetadata{
+		TxIndex:     txIndex,
+		InboxAddr:   testInbox,
+		BlockNumber: blockNumber,
+		BlockHash:   common.BigToHash(new(big.Int).SetUint64(blockNumber)),
+		BlockTime:   blockNumber * 12,
+		ChainId:     1,
+		ValidSender: true,
+		Frames:      frames,
+		Tx:          tx,
+	}
+	return writeTestTxm(t, dir, blocksPerDir, txm)
+}
+
+func writeTestTxm(t *testing.T, dir string, blocksPerDir uint64, txm fetch.TransactionWithMetadata) fetch.TransactionWithMetadata {
+	filename := fetch.CacheFilePath(dir, blocksPerDir, txm.BlockNumber, txm.Tx.Hash())
+	require.NoError(t, os.MkdirAll(path.Dir(filename), 0750))
+	data, err := json.Marshal(txm)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, data, 0644))
+	return txm
+}
+
+func TestLoadFramesShardedCache(t *testing.T) {
+	id := derive.ChannelID{0x01}
+	dir := t.TempDir()
+	// Mix the legacy flat layout with the sharded layout to ensure both are read.
+	writeTestTx(t, dir, 0, 5, 0, derive.Frame{ID: id, FrameNumber: 0})
+	writeTestTx(t, dir, 10, 12, 1, derive.Frame{ID: id, FrameNumber: 1})
+	writeTestTx(t, dir, 10, 25, 0, derive.Frame{ID: id, FrameNumber: 2, IsLast: true})
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3, "expected one flat file and two shard directories")
+
+	frames := LoadFrames(dir, testInbox)
+	require.Len(t, frames, 3)
+	for i, frame := range frames {
+		require.Equal(t, uint16(i), frame.Frame.FrameNumber)
+	}
+	require.Equal(t, uint64(5), frames[0].InclusionBlock)
+	require.Equal(t, uint64(12), frames[1].InclusionBlock)
+	require.Equal(t, uint64(25), frames[2].InclusionBlock)
+}
+
+func TestLoadFramesDeterministicOrder(t *testing.T) {
+	type testTx struct {
+		block, index uint64
+		frames       []derive.Frame
+	}
+	a, b := derive.ChannelID{0x0a}, derive.ChannelID{0x0b}
+	txs := []testTx{
+		{block: 3, index: 0, frames: []derive.Frame{{ID: a, FrameNumber: 0}, {ID: b, FrameNumber: 0}}},
+		{block: 3, index: 2, frames: []derive.Frame{{ID: a, FrameNumber: 1}}},
+		{block: 7, index: 1, frames: []derive.Frame{{ID: b, FrameNumber: 1, IsLast: true}}},
+		{block: 9, index: 0, frames: []derive.Frame{{ID: a, FrameNumber: 2, IsLast: true}}},
+	}
+	var expected []FrameWithMetadata
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5; i++ {
+		dir := t.TempDir()
+		for _, j := range rng.Perm(len(txs)) {
+			writeTestTx(t, dir, 0, txs[j].block, txs[j].index, txs[j].frames...)
+		}
+		// A conflicting version of block 7 with a different transaction at the same index.
+		conflict := writeTestTxData(t, dir, 0, 7, 1, types.NewTx(&types.DynamicFeeTx{
+			ChainID: big.NewInt(1),
+			Nonce:   1,
+			To:      &testInbox,
+		}), derive.Frame{ID: b, FrameNumber: 1})
+		conflict.BlockHash = common.Hash{0xff}
+		writeTestTxm(t, dir, 0, conflict)
+
+		frames := LoadFrames(dir, testInbox)
+		require.Len(t, frames, 6)
+		if expected == nil {
+			expected = frames
+		}
+		require.Equal(t, expected, frames)
+	}
+	var order []derive.Frame
+	for _, frame := range expected {
+		order = append(order, frame.Frame)
+	}
+	require.Equal(t, []derive.Frame{
+		{ID: a, FrameNumber: 0}, {ID: b, FrameNumber: 0},
+		{ID: a, FrameNumber: 1},
+		{ID: b, FrameNumber: 1, IsLast: true}, {ID: b, FrameNumber: 1},
+		{ID: a, FrameNumber: 2, IsLast: true},
+	}, order)
+}
+
+func TestLoadFramesSortsFramesInTransaction(t *testing.T) {
+	a, b := derive.ChannelID{0x0a}, derive.ChannelID{0x0b}
+	dir := t.TempDir()
+	writeTestTx(t, dir, 0, 3, 0,
+		derive.Frame{ID: a, FrameNumber: 2, IsLast: true},
+		derive.Frame{ID: b, FrameNumber: 1},
+		derive.Frame{ID: a, FrameNumber: 0},
+		derive.Frame{ID: b, FrameNumber: 0},
+		derive.Frame{ID: a, FrameNumber: 1},
+	)
+	var order []derive.Frame
+	for _, frame := range LoadFrames(dir, testInbox) {
+		order = append(order, frame.Frame)
+	}
+	require.Equal(t, []derive.Frame{
+		{ID: a, FrameNumber: 0}, {ID: b, FrameNumber: 0},
+		{ID: b, FrameNumber: 1}, {ID: a, FrameNumber: 1},
+		{ID: a, FrameNumber: 2, IsLast: true},
+	}, order)
+}
+
+func TestChannelsUnregisteredChain(t *testing.T) {
+	dir := t.TempDir()
+	frames := spanBatchFrames(t, 110, 5, 30)
+	for i, frame := range frames {
+		writeTestTx(t, dir, 0, uint64(20+i), 0, frame)
+	}
+	config := testConfig(dir)
+	config.OutDirectory = t.TempDir()
+	Channels(config, config.RollupConfig())
+
+	data, err := os.ReadFile(path.Join(config.OutDirectory, frames[0].ID.String()+".json"))
+	require.NoError(t, err)
+	var ch struct {
+		IsReady        bool  `json:"is_ready"`
+		InvalidBatches bool  `json:"invalid_batches"`
+		BatchTypes     []int `json:"batch_types"`
+	}
+	require.NoError(t, json.Unmarshal(data, &ch))
+	require.True(t, ch.IsReady)
+	require.False(t, ch.InvalidBatches)
+	require.Len(t, ch.BatchTypes, 1)
+
+	state := ChannelBank(config, config.RollupConfig(), 0)
+	require.Empty(t, state.Channels)
+}
+
+func TestFindBlobBlock(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTx(t, dir, 0, 5, 0, derive.Frame{ID: derive.ChannelID{0x01}})
+	hash := common.Hash{0x01, 0x02}
+	writeTestTxData(t, dir, 0, 7, 1, types.NewTx(&types.BlobTx{
+		ChainID:    uint256.NewInt(1),
+		To:         testInbox,
+		BlobHashes: []common.Hash{{0x01, 0x01}, hash},
+	}))
+
+	block, err := FindBlobBlock(dir, hash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), block)
+
+	_, err = FindBlobBlock(dir, common.Hash{0x03})
+	require.ErrorContains(t, err, "not found")
+}
+
+var testRollupCfg = &rollup.Config{
+	Genesis: rollup.Genesis{
+		L2:     eth.BlockID{Number: 100},
+		L2Time: 1000,
+	},
+	BlockTime: 2,
+	L2ChainID: big.NewInt(10),
+}
+
+func testConfig(dir string) Config {
+	return Config{
+		BatchInbox:    testInbox,
+		InDirectory:   dir,
+		L2ChainID:     testRollupCfg.L2ChainID,
+		L2GenesisTime: testRollupCfg.Genesis.L2Time,
+		L2BlockTime:   testRollupCfg.BlockTime,
+	}
+}
+
+// spanBatchFrames encodes a span batch covering the given L2 blocks into frames of at most maxFrameSize bytes.
+func spanBatchFrames(t *testing.T, firstBlock, blockCount uint64, maxFrameSize uint64) []derive.Frame {
+	spec := rollup.NewChainSpec(testRollupCfg)
+	co, err := derive.NewSpanChannelOut(testRollupCfg.Genesis.L2Time, testRollupCfg.L2ChainID, 100_000, derive.Zlib, spec)
+	require.NoError(t, err)
+	for i := uint64(0); i < blockCount; i++ {
+		batch := &derive.SingularBatch{
+			EpochNum:  rollup.Epoch(1),
+			Timestamp: testRollupCfg.TimestampForBlock(firstBlock + i),
+		}
+		require.NoError(t, co.AddSingularBatch(batch, 0))
+	}
+	require.NoError(t, co.Close())
+	var frames []derive.Frame
+	for {
+		var buf bytes.Buffer
+		_, err := co.OutputFrame(&buf, maxFrameSize)
+		if err != nil && err != io.EOF {
+			require.NoError(t, err)
+		}
+		var frame derive.Frame
+		require.NoError(t, frame.UnmarshalBinary(&buf))
+		frames = append(frames, frame)
+		if err == io.EOF {
+			return frames
+		}
+	}
+}
+
+func TestBatchRangesByTx(t *testing.T) {
+	dir := t.TempDir()
+	frames := spanBatchFrames(t, 110, 5, 40)
+	require.Greater(t, len(frames), 1, "expected the channel to span multiple transactions")
+	var txs []fetch.TransactionWithMetadata
+	for i, frame := range frames {
+		txs = append(txs, writeTestTx(t, dir, 0, uint64(20+i), 0, frame))
+	}
+	// A transaction of an unrelated channel
+	other := writeTestTx(t, dir, 0, 50, 0, spanBatchFrames(t, 200, 2, 1000)...)
+
+	result, err := BatchRangesByTx(testConfig(dir), testRollupCfg, txs[1].Tx.Hash())
+	require.NoError(t, err)
+	require.Equal(t, []derive.ChannelID{frames[0].ID}, result.Channels)
+	require.Equal(t, []BatchRange{{
+		ChannelID:  frames[0].ID,
+		BatchType:  derive.SpanBatchType,
+		StartBlock: 110,
+		EndBlock:   114,
+	}}, result.Ranges)
+
+	result, err = BatchRangesByTx(testConfig(dir), testRollupCfg, other.Tx.Hash())
+	require.NoError(t, err)
+	require.Len(t, result.Ranges, 1)
+	require.Equal(t, uint64(200), result.Ranges[0].StartBlock)
+	require.Equal(t, uint64(201), result.Ranges[0].EndBlock)
+
+	_, err = BatchRangesByTx(testConfig(dir), testRollupCfg, common.Hash{0xde, 0xad})
+	require.ErrorContains(t, err, "no frames found")
+}
+
+func TestBench(t *testing.T) {
+	dir := t.TempDir()
+	for i, frame := range spanBatchFrames(t, 110, 5, 40) {
+		writeTestTx(t, dir, 0, uint64(20+i/2), uint64(i%2), frame)
+	}
+	writeTestTx(t, dir, 0, 50, 0, spanBatchFrames(t, 115, 3, 1000)...)
+
+	report := Bench(testConfig(dir), testRollupCfg)
+	require.Equal(t, uint64(2), report.Channels)
+	require.Equal(t, uint64(8), report.L2Blocks)
+	require.NotZero(t, report.Frames)
+	require.NotZero(t, report.L1Blocks)
+	require.NotZero(t, report.DecompressedBytes)
+	require.NotZero(t, report.PeakHeapBytes)
+}
+
+func TestMixedTransportChannel(t *testing.T) {
+	dir := t.TempDir()
+	frames := spanBatchFrames(t, 110, 5, 30)
+	require.GreaterOrEqual(t, len(frames), 3)
+	// The first frame is posted as calldata, the remaining ones in blobs. Write the blob
+	// transactions first to ensure ordering is based on the L1 position, not the transport.
+	for i := 1; i < len(frames); i++ {
+		writeTestBlobTx(t, dir, 0, uint64(30+i), 0, frames[i])
+	}
+	writeTestTx(t, dir, 0, 30, 0, frames[0])
+
+	loaded := LoadFrames(dir, testInbox)
+	require.Len(t, loaded, len(frames))
+	require.Equal(t, TransportCalldata, loaded[0].Transport)
+	for i, frame := range loaded {
+		require.Equal(t, uint16(i), frame.Frame.FrameNumber)
+		if i > 0 {
+			require.Equal(t, TransportBlob, frame.Transport)
+		}
+	}
+
+	ch := processFrames(testConfig(dir), testRollupCfg, frames[0].ID, loaded)
+	require.True(t, ch.IsReady)
+	require.True(t, ch.MixedTransports)
+	require.False(t, ch.InvalidBatches)
+	require.Len(t, ch.Batches, 1)
+
+	single := processFrames(testConfig(dir), testRollupCfg, frames[0].ID, loaded[1:2])
+	require.False(t, single.MixedTransports)
+}
+
+func TestChannelBankStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	complete := spanBatchFrames(t, 110, 5, 30)
+	require.Greater(t, len(complete), 2)
+	for i, frame := range complete {
+		writeTestTx(t, dir, 0, uint64(20+i), 0, frame)
+	}
+	incomplete := spanBatchFrames(t, 115, 5, 30)
+	require.Greater(t, len(incomplete), 2)
+	// Only the first and the last frame of the second channel are posted.
+	writeTestTx(t, dir, 0, 21, 1, incomplete[0])
+	writeTestTx(t, dir, 0, 40, 0, incomplete[len(incomplete)-1])
+
+	t.Run("AtBlock", func(t *testing.T) {
+		// At block 21, both channels are still open.
+		state := ChannelBank(testConfig(dir), testRollupCfg, 21)
+		require.Equal(t, uint64(21), state.L1Block)
+		require.Len(t, state.Channels, 2)
+		require.Equal(t, complete[0].ID, state.Channels[0].ID)
+		require.Len(t, state.Channels[0].Frames, 2)
+		require.Equal(t, incomplete[0].ID, state.Channels[1].ID)
+		require.False(t, state.Channels[1].LastSeen)
+	})
+
+	t.Run("AllBlocks", func(t *testing.T) {
+		state := ChannelBank(testConfig(dir), testRollupCfg, 0)
+		require.Equal(t, uint64(40), state.L1Block)
+		require.Len(t, state.Channels, 1, "the complete channel must be read out of the bank")
+		buffered := state.Channels[0]
+		require.Equal(t, incomplete[0].ID, buffered.ID)
+		require.Equal(t, uint64(21), buffered.OpenBlock)
+		require.True(t, buffered.LastSeen)
+		require.Len(t, buffered.Frames, 2)
+
+		filename := path.Join(t.TempDir(), "channel_bank.json")
+		require.NoError(t, WriteChannelBankState(state, filename))
+		loaded, err := LoadChannelBankState(filename)
+		require.NoError(t, err)
+		require.Equal(t, state, loaded)
+	})
+}
+
+type fakeL1 map[uint64]*types.Header
+
+func (f fakeL1) HeaderByNumber(_ context.Context, number *big.Int) (*types.Header, error) {
+	if h, ok := f[number.Uint64()]; ok {
+		return h, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestBlockConflicts(t *testing.T) {
+	dir := t.TempDir()
+	id := derive.ChannelID{0x01}
+	writeTestTx(t, dir, 0, 4, 0, derive.Frame{ID: id, FrameNumber: 0})
+	// The same transaction cached twice, in the flat and in the sharded layout, isn't a conflict.
+	orig := writeTestTx(t, dir, 0, 5, 0, derive.Frame{ID: id, FrameNumber: 1})
+	writeTestTxm(t, dir, 10, orig)
+
+	canonical := &types.Header{Number: big.NewInt(5), Extra: []byte("canonical")}
+	reorged := writeTestTx(t, dir, 0, 5, 1, derive.Frame{ID: id, FrameNumber: 2, IsLast: true})
+	reorged.BlockHash = canonical.Hash()
+	writeTestTxm(t, dir, 0, reorged)
+
+	txns := loadTransactions(dir, testInbox)
+	require.Len(t, txns, 4)
+	conflicts := FindBlockConflicts(txns)
+	require.Len(t, conflicts, 1)
+	require.Equal(t, uint64(5), conflicts[0].Number)
+	require.ElementsMatch(t, []common.Hash{orig.BlockHash, reorged.BlockHash}, conflicts[0].Hashes)
+
+	t.Run("Fail", func(t *testing.T) {
+		_, err := loadFrames(testConfig(dir))
+		require.ErrorContains(t, err, "block 5")
+	})
+
+	t.Run("CanonicalWithoutL1", func(t *testing.T) {
+		config := testConfig(dir)
+		config.ConflictPolicy = ConflictPolicyCanonical
+		_, err := loadFrames(config)
+		require.Error(t, err)
+	})
+
+	t.Run("Canonical", func(t *testing.T) {
+		config := testConfig(dir)
+		config.ConflictPolicy = ConflictPolicyCanonical
+		config.L1 = fakeL1{5: canonical}
+		frames, err := loadFrames(config)
+		require.NoError(t, err)
+		require.Len(t, frames, 2)
+		require.Equal(t, uint16(0), frames[0].Frame.FrameNumber)
+		require.Equal(t, uint16(2), frames[1].Frame.FrameNumber)
+		require.Equal(t, reorged.Tx.Hash(), frames[1].TxHash)
+	})
+}
+
+func TestCheckForceClose(t *testing.T) {
+	id := derive.ChannelID{0x01}
+
+	t.Run("Open", func(t *testing.T) {
+		check := CheckForceClose(id, []derive.Frame{{ID: id, FrameNumber: 0}, {ID: id, FrameNumber: 2}})
+		require.Equal(t, 2, check.Frames)
+		require.False(t, check.Closed)
+		require.False(t, check.LastFrameIsLast)
+		require.Equal(t, uint16(2), check.HighestFrameNumber)
+		require.Equal(t, []uint16{1}, check.MissingFrames)
+	})
+
+	t.Run("ClosedWithGaps", func(t *testing.T) {
+		check := CheckForceClose(id, []derive.Frame{{ID: id, FrameNumber: 3, IsLast: true}, {ID: id, FrameNumber: 1}})
+		require.True(t, check.Closed)
+		require.True(t, check.LastFrameIsLast)
+		require.Equal(t, []uint16{0, 2}, check.MissingFrames)
+	})
+
+	t.Run("FramesAfterClose", func(t *testing.T) {
+		check := CheckForceClose(id, []derive.Frame{{ID: id, FrameNumber: 0, IsLast: true}, {ID: id, FrameNumber: 1}})
+		require.True(t, check.Closed)
+		require.False(t, check.LastFrameIsLast)
+		require.Empty(t, check.MissingFrames)
+	})
+
+	t.Run("NoFrames", func(t *testing.T) {
+		check := CheckForceClose(id, nil)
+		require.Zero(t, check.Frames)
+		require.False(t, check.Closed)
+	})
+}
+
+func TestDecodeFrames(t *testing.T) {
+	id := derive.ChannelID{0x01}
+	var buf bytes.Buffer
+	buf.WriteByte(derive.DerivationVersion0)
+	require.NoError(t, (&derive.Frame{ID: id, FrameNumber: 0, Data: []byte{1, 2, 3}}).MarshalBinary(&buf))
+	require.NoError(t, (&derive.Frame{ID: id, FrameNumber: 1, Data: []byte{4}, IsLast: true}).MarshalBinary(&buf))
+
+	frames, err := DecodeFrames(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, []FrameSummary{
+		{ID: id, FrameNumber: 0, DataLength: 3},
+		{ID: id, FrameNumber: 1, DataLength: 1, IsLast: true},
+	}, frames)
+
+	_, err = DecodeFrames([]byte{0x01, 0x02})
+	require.ErrorContains(t, err, "invalid frame data")
+}
+
+type mapStore map[string][]byte
+
+func (m mapStore) ListKeys(_ context.Context, bucket, prefix string) ([]string, error) {
+	var keys []string
+	for key := range m {
+		if strings.HasPrefix(key, bucket+"/"+prefix) {
+			keys = append(keys, strings.TrimPrefix(key, bucket+"/"))
+		}
+	}
+	return keys, nil
+}
+
+func (m mapStore) GetObject(_ context.Context, bucket, key string) ([]byte, error) {
+	data, ok := m[bucket+"/"+key]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	return data, nil
+}
+
+func TestS3TxSource(t *testing.T) {
+	id := derive.ChannelID{0x01}
+	dir := t.TempDir()
+	store := make(mapStore)
+	put := func(key string, txm fetch.TransactionWithMetadata) {
+		data, err := json.Marshal(txm)
+		require.NoError(t, err)
+		store[key] = data
+	}
+	put("bucket/cache/0-9/a.json", writeTestTx(t, dir, 0, 5, 0, derive.Frame{ID: id, FrameNumber: 0}))
+	put("bucket/cache/10-19/b.json", writeTestTx(t, dir, 0, 12, 0, derive.Frame{ID: id, FrameNumber: 1, IsLast: true}))
+	put("bucket/other/c.json", writeTestTx(t, dir, 0, 13, 0, derive.Frame{ID: derive.ChannelID{0x02}}))
+	store["bucket/cache/"+fetch.ManifestFile] = []byte("{}")
+	store["bucket/cache/notes.txt"] = []byte("not a transaction")
+	store["bucket/cache/10-19/"] = nil
+
+	src := NewS3TxSourceWithStore(store, "bucket", "/cache")
+	names, err := src.List(context.Background())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"cache/0-9/a.json", "cache/10-19/b.json"}, names)
+
+	txns, err := loadSourceTransactions(context.Background(), src, testInbox)
+	require.NoError(t, err)
+	require.Len(t, txns, 2)
+
+	// The local cache, holding all three transactions, is read through the same interface.
+	require.NoError(t, os.WriteFile(path.Join(dir, "notes.txt"), []byte("not a transaction"), 0644))
+	txns, err = loadSourceTransactions(context.Background(), DirTxSource(dir), testInbox)
+	require.NoError(t, err)
+	require.Len(t, txns, 3)
+
+	store["bucket/cache/0-9/a.json"] = []byte("{")
+	_, err = loadSourceTransactions(context.Background(), src, testInbox)
+	require.ErrorContains(t, err, "failed to decode cache/0-9/a.json")
+}
+
+func TestBatchSummaries(t *testing.T) {
+	dir := t.TempDir()
+	for i, frame := range spanBatchFrames(t, 110, 3, 1000) {
+		writeTestTx(t, dir, 0, uint64(20+i), 0, frame)
+	}
+	var out bytes.Buffer
+	config := testConfig(dir)
+	config.OutDirectory = t.TempDir()
+	config.BatchSummaries = &out
+	Channels(config, testRollupCfg)
+
+	dec := json.NewDecoder(&out)
+	for i := 0; i < 3; i++ {
+		var summary BatchSummary
+		require.NoError(t, dec.Decode(&summary))
+		require.Equal(t, derive.SpanBatchType, summary.BatchType)
+		require.Equal(t, testRollupCfg.TimestampForBlock(110+uint64(i)), summary.Timestamp)
+		require.Equal(t, uint64(1), summary.Epoch)
+		require.Equal(t, 3, summary.BlockCount)
+		require.Equal(t, i, summary.Index)
+	}
+	require.False(t, dec.More())
+
+	ch := ChannelWithMetadata{
+		ID:      derive.ChannelID{0x02},
+		Batches: []derive.Batch{&derive.SingularBatch{EpochNum: 4, Timestamp: 1020}, (*derive.SingularBatch)(nil)},
+	}
+	require.Equal(t, []BatchSummary{
+		{ChannelID: ch.ID, BatchType: derive.SingularBatchType, Timestamp: 1020, Epoch: 4, BlockCount: 1},
+	}, ChannelBatchSummaries(ch))
+}
+
+func TestReportIncomplete(t *testing.T) {
+	dir := t.TempDir()
+	for i, frame := range spanBatchFrames(t, 110, 5, 30) {
+		writeTestTx(t, dir, 0, uint64(20+i), 0, frame)
+	}
+	incomplete := spanBatchFrames(t, 115, 5, 30)
+	require.Greater(t, len(incomplete), 2)
+	// The second frame of the second channel is never posted.
+	writeTestTx(t, dir, 0, 21, 1, incomplete[0])
+	writeTestTx(t, dir, 0, 40, 0, incomplete[2])
+
+	config := testConfig(dir)
+	config.OutDirectory = t.TempDir()
+	config.IncompleteReport = path.Join(t.TempDir(), "incomplete.json")
+	var log bytes.Buffer
+	config.Log = &log
+	Channels(config, testRollupCfg)
+	require.Contains(t, log.String(), fmt.Sprintf("Channel %v is not ready", incomplete[0].ID))
+	require.Contains(t, log.String(), "Wrote report of 1 incomplete channels")
+
+	data, err := os.ReadFile(config.IncompleteReport)
+	require.NoError(t, err)
+	var report []IncompleteChannel
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, []IncompleteChannel{{
+		ID:                 incomplete[0].ID,
+		Frames:             2,
+		HighestFrameNumber: 2,
+		MissingFrames:      []uint16{1},
+		LastSeen:           incomplete[2].IsLast,
+		Bytes:              uint64(len(incomplete[0].Data) + len(incomplete[2].Data)),
+		FirstBlock:         21,
+		LastBlock:          40,
+	}}, report)
+}
+
+func TestCheckManifest(t *testing.T) {
+	dir := t.TempDir()
+	config := testConfig(dir)
+	rollupCfg := *testRollupCfg
+	rollupCfg.L1ChainID = big.NewInt(900)
+
+	warnings, err := checkManifest(config, &rollupCfg)
+	require.NoError(t, err)
+	require.Empty(t, warnings, "caches without a manifest are not checked")
+
+	require.NoError(t, fetch.WriteManifest(dir, fetch.Manifest{ChainID: 900, BatchInbox: testInbox}))
+	warnings, err = checkManifest(config, &rollupCfg)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	require.NoError(t, fetch.WriteManifest(dir, fetch.Manifest{ChainID: 1, BatchInbox: common.Address{0x01}}))
+	warnings, err = checkManifest(config, &rollupCfg)
+	require.NoError(t, err)
+	require.Len(t, warnings, 2)
+	require.Contains(t, warnings[0], "batch inbox")
+	require.Contains(t, warnings[1], "L1 chain 1")
+}
+
+func TestChannelCosts(t *testing.T) {
+	a, b := derive.ChannelID{0x0a}, derive.ChannelID{0x0b}
+	calldataTx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		To:        &testInbox,
+		GasFeeCap: big.NewInt(10),
+		Data:      []byte{0x00, 0x01, 0x02},
+	})
+	blobTx := types.NewTx(&types.BlobTx{
+		ChainID:    uint256.NewInt(1),
+		To:         testInbox,
+		GasFeeCap:  uint256.NewInt(2),
+		BlobFeeCap: uint256.NewInt(3),
+		BlobHashes: []common.Hash{{0x01}},
+	})
+	txns := []fetch.TransactionWithMetadata{
+		// The frames of a and b are 24 and 26 bytes including the frame overhead.
+		{Tx: calldataTx, Frames: []derive.Frame{{ID: a, Data: []byte{0x01}}, {ID: b, Data: []byte{0x01, 0x02, 0x03}}}},
+		{Tx: blobTx, Frames: []derive.Frame{{ID: a, Data: make([]byte, 5)}}},
+		// Transactions without frames are not attributed.
+		{Tx: calldataTx},
+	}
+	report := ChannelCosts(txns)
+	require.Equal(t, []ChannelCost{
+		{
+			ID:            a,
+			Transactions:  2,
+			CalldataBytes: 3 * 24 / 50,
+			BlobBytes:     131072,
+			ExecutionGas:  21036*24/50 + 21000,
+			BlobGas:       131072,
+			MaxFee:        big.NewInt(210360*24/50 + 21000*2 + 131072*3),
+		},
+		{
+			ID:            b,
+			Transactions:  1,
+			CalldataBytes: 3 * 26 / 50,
+			ExecutionGas:  21036 * 26 / 50,
+			MaxFee:        big.NewInt(210360 * 26 / 50),
+		},
+	}, report.Channels)
+	require.Equal(t, uint64(3), report.CalldataBytes)
+	require.Equal(t, uint64(131072), report.BlobBytes)
+	require.Equal(t, uint64(21036+21000), report.ExecutionGas)
+	require.Equal(t, uint64(131072), report.BlobGas)
+	require.Equal(t, big.NewInt(210360+21000*2+131072*3), report.MaxFee)
+
+	dir := t.TempDir()
+	frames := spanBatchFrames(t, 110, 5, 30)
+	for i, frame := range frames {
+		writeTestTx(t, dir, 0, uint64(20+i), 0, frame)
+	}
+	config := testConfig(dir)
+	config.OutDirectory = t.TempDir()
+	config.CostReport = path.Join(t.TempDir(), "cost.json")
+	Channels(config, testRollupCfg)
+	data, err := os.ReadFile(config.CostReport)
+	require.NoError(t, err)
+	var written CostReport
+	require.NoError(t, json.Unmarshal(data, &written))
+	require.Len(t, written.Channels, 1)
+	require.Equal(t, len(frames), written.Channels[0].Transactions)
+	// The test transactions carry no calldata.
+	require.Equal(t, uint64(21000*len(frames)), written.ExecutionGas)
+}
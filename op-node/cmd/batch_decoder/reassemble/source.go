@@ -0,0 +1,149 @@
+package reassemble
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// TxSource provides access to the files of a transaction cache written by fetch.
+type TxSource interface {
+	// List returns the names of all transaction files of the cache.
+	List(ctx context.Context) ([]string, error)
+	// Read returns the contents of the named transaction file.
+	Read(ctx context.Context, name string) ([]byte, error)
+}
+
+// OpenTxSource opens the transaction cache at in, which is either a local directory or an
+// s3://<bucket>/<prefix> URL.
+func OpenTxSource(in string) (TxSource, error) {
+	if strings.HasPrefix(in, "s3://") {
+		return NewS3TxSource(in)
+	}
+	return DirTxSource(in), nil
+}
+
+// DirTxSource reads the transaction cache from a local directory.
+// Both the flat cache layout and the sharded layout (one subdirectory per L1 block range) are supported.
+type DirTxSource string
+
+func (d DirTxSource) List(ctx context.Context) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(string(d), func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || fetch.IsMetadataFile(entry.Name()) || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		names = append(names, p)
+		return nil
+	})
+	return names, err
+}
+
+func (d DirTxSource) Read(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// ObjectStore is the subset of an S3 client used to read a transaction cache.
+type ObjectStore interface {
+	ListKeys(ctx context.Context, bucket, prefix string) ([]string, error)
+	GetObject(ctx context.Context, bucket, key string) ([]byte, error)
+}
+
+// S3TxSource reads the transaction cache from the objects below a prefix of an S3 bucket.
+type S3TxSource struct {
+	store  ObjectStore
+	bucket string
+	prefix string
+}
+
+// NewS3TxSource connects to the S3 bucket of the s3://<bucket>/<prefix> URL. Credentials are read
+// from the standard AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+// AWS_ENDPOINT_URL selects an S3-compatible endpoint other than AWS.
+func NewS3TxSource(in string) (*S3TxSource, error) {
+	u, err := url.Parse(in)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 URL %q: %w", in, err)
+	}
+	endpoint, secure := "s3.amazonaws.com", true
+	if e := os.Getenv("AWS_ENDPOINT_URL"); e != "" {
+		eu, err := url.Parse(e)
+		if err != nil || eu.Host == "" {
+			return nil, fmt.Errorf("invalid AWS_ENDPOINT_URL %q", e)
+		}
+		endpoint, secure = eu.Host, eu.Scheme != "http"
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewEnvAWS(),
+		Secure: secure,
+		Region: os.Getenv("AWS_REGION"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewS3TxSourceWithStore(&minioStore{client: client}, u.Host, u.Path), nil
+}
+
+// NewS3TxSourceWithStore reads the transaction cache below prefix of the bucket from the given object store.
+func NewS3TxSourceWithStore(store ObjectStore, bucket, prefix string) *S3TxSource {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3TxSource{store: store, bucket: bucket, prefix: prefix}
+}
+
+func (s *S3TxSource) List(ctx context.Context) ([]string, error) {
+	keys, err := s.store.ListKeys(ctx, s.bucket, s.prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list s3://%s/%s: %w", s.bucket, s.prefix, err)
+	}
+	var names []string
+	for _, key := range keys {
+		if fetch.IsMetadataFile(path.Base(key)) || path.Ext(key) != ".json" {
+			continue
+		}
+		names = append(names, key)
+	}
+	return names, nil
+}
+
+func (s *S3TxSource) Read(ctx context.Context, name string) ([]byte, error) {
+	return s.store.GetObject(ctx, s.bucket, name)
+}
+
+type minioStore struct {
+	client *minio.Client
+}
+
+func (m *minioStore) ListKeys(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var keys []string
+	for obj := range m.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+func (m *minioStore) GetObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	obj, err := m.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}